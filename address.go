@@ -0,0 +1,312 @@
+package gomime
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// AddressGroup is RFC 5322 group of addresses, e.g. `team: a@b, c@d;`
+type AddressGroup struct {
+	Name      string
+	Addresses []*mail.Address
+	// Start is index of the first member in AddressList.Addresses, it
+	// keeps position of empty group in the list too
+	Start int
+}
+
+// AddressList is result of ParseAddressList
+type AddressList struct {
+	// Addresses of all mailboxes in order, including members of groups
+	Addresses []*mail.Address
+	Groups    []*AddressGroup
+	// Unparsed fragments of the list which are not valid addresses
+	Unparsed []string
+}
+
+// ParseAddressList parses address list (e.g. value of To header) leniently.
+// Unlike mail.ParseAddressList it does not fail on the first invalid
+// address. It supports groups, comments (used as name of address without
+// display name), obsolete routes, quoted names with commas and semicolons,
+// encoded-words also inside quoted names, raw 8-bit names and non-ASCII
+// (IDN) domains which are kept as they are.
+func ParseAddressList(raw string) *AddressList {
+	list := &AddressList{}
+	tokens := tokenizeAddressList(raw)
+
+	var group *AddressGroup
+	finishItem := func(item []addressToken) {
+		if len(item) == 0 {
+			return
+		}
+		address := parseMailbox(item)
+		if address == nil {
+			fragment := strings.TrimSpace(raw[item[0].start:item[len(item)-1].end])
+			if fragment != "" {
+				list.Unparsed = append(list.Unparsed, fragment)
+			}
+			return
+		}
+		list.Addresses = append(list.Addresses, address)
+		if group != nil {
+			group.Addresses = append(group.Addresses, address)
+		}
+	}
+
+	var item []addressToken
+	for i := 0; i < len(tokens); i++ {
+		token := tokens[i]
+		switch {
+		case token.is('<'):
+			// angle address including obsolete route is one item
+			for ; i < len(tokens) && !tokens[i].is('>'); i++ {
+				item = append(item, tokens[i])
+			}
+			if i < len(tokens) {
+				item = append(item, tokens[i])
+			}
+		case token.is(',') && len(item) > 0 && !hasAddressTokens(item) && continuesDisplayName(tokens[i+1:]):
+			// unquoted display name with comma, e.g. `Doe, John <john@doe>`
+			item = append(item, token)
+		case token.is(','):
+			finishItem(item)
+			item = nil
+		case token.is(':') && group == nil && !hasAddressTokens(item):
+			group = &AddressGroup{Name: decodePhrase(item), Start: len(list.Addresses)}
+			list.Groups = append(list.Groups, group)
+			item = nil
+		case token.is(';'):
+			finishItem(item)
+			item, group = nil, nil
+		default:
+			item = append(item, token)
+		}
+	}
+	finishItem(item)
+	return list
+}
+
+// hasAddressTokens returns true for item which contains address
+func hasAddressTokens(item []addressToken) bool {
+	for _, token := range item {
+		if token.is('@') || token.is('<') {
+			return true
+		}
+	}
+	return false
+}
+
+// continuesDisplayName returns true when tokens up to the next comma
+// contain angle address and no group
+func continuesDisplayName(tokens []addressToken) bool {
+	for _, token := range tokens {
+		switch {
+		case token.is(',') || token.is(';') || token.is(':') || token.is('@'):
+			return false
+		case token.is('<'):
+			return true
+		}
+	}
+	return false
+}
+
+// parseMailbox parses `name <addr-spec>` or `addr-spec (comment)`
+func parseMailbox(item []addressToken) *mail.Address {
+	var phrase, spec, comments []addressToken
+	angle := -1
+	for i, token := range item {
+		switch {
+		case token.kind == addressTokenComment:
+			comments = append(comments, token)
+		case token.is('<'):
+			if angle >= 0 {
+				return nil
+			}
+			angle = i
+		case token.is('>'):
+		case angle >= 0:
+			spec = append(spec, token)
+		default:
+			phrase = append(phrase, token)
+		}
+	}
+	if angle < 0 {
+		spec, phrase = phrase, nil
+	}
+
+	// obsolete route `@a,@b:user@domain`
+	for i := len(spec) - 1; i >= 0; i-- {
+		if spec[i].is(':') {
+			spec = spec[i+1:]
+			break
+		}
+	}
+	address := parseAddrSpec(spec)
+	if address == "" {
+		return nil
+	}
+
+	name := decodePhrase(phrase)
+	if name == "" && len(comments) > 0 {
+		name = decodePhrase(comments)
+	}
+	return &mail.Address{Name: name, Address: address}
+}
+
+// parseAddrSpec returns `local@domain` or empty string for invalid address
+func parseAddrSpec(spec []addressToken) string {
+	at := -1
+	for i, token := range spec {
+		if token.is('@') {
+			at = i
+		}
+	}
+	if at <= 0 || at == len(spec)-1 {
+		return ""
+	}
+	local, ok := joinDotted(spec[:at], true)
+	if !ok {
+		return ""
+	}
+	domain, ok := joinDotted(spec[at+1:], false)
+	if !ok {
+		return ""
+	}
+	return local + "@" + domain
+}
+
+// joinDotted joins words separated by dots. Quoted strings are allowed in
+// local part and domain literal in domain.
+func joinDotted(tokens []addressToken, isLocal bool) (string, bool) {
+	buf := &strings.Builder{}
+	for _, token := range tokens {
+		switch {
+		case token.is('.'), token.kind == addressTokenAtom:
+		case token.kind == addressTokenQuoted && isLocal:
+		case token.kind == addressTokenLiteral && !isLocal && len(tokens) == 1:
+		default:
+			return "", false
+		}
+		buf.WriteString(token.value)
+	}
+	joined := buf.String()
+	if joined == "" || strings.HasPrefix(joined, ".") || strings.HasSuffix(joined, ".") {
+		return "", false
+	}
+	return joined, true
+}
+
+// decodePhrase returns display name made of words and decodes
+// encoded-words and raw 8-bit text in it
+func decodePhrase(tokens []addressToken) string {
+	buf := &strings.Builder{}
+	for i, token := range tokens {
+		if i > 0 && token.space {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(token.value)
+	}
+	name := strings.TrimSpace(buf.String())
+	if decoded, err := DecodeHeaderWithFallback(name); err == nil {
+		name = decoded
+	}
+	return name
+}
+
+const (
+	addressTokenAtom = iota
+	addressTokenQuoted
+	addressTokenComment
+	addressTokenLiteral
+	addressTokenSpecial
+)
+
+// addressToken is lexical token of address list. Value of quoted string
+// and comment is without quotes and with quoted pairs resolved.
+type addressToken struct {
+	kind       int
+	value      string
+	start, end int
+	// space is true when token follows whitespace or comment
+	space bool
+}
+
+func (t addressToken) is(special byte) bool {
+	return t.kind == addressTokenSpecial && t.value[0] == special
+}
+
+const addressSpecials = "()<>[]:;@\\,.\""
+
+// tokenizeAddressList splits raw address list to tokens. Unterminated
+// quoted string, comment and domain literal end at the end of raw.
+func tokenizeAddressList(raw string) (tokens []addressToken) {
+	space := false
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		token := addressToken{start: i, space: space}
+		space = false
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			space = true
+			i++
+			continue
+		case c == '"':
+			token.kind = addressTokenQuoted
+			token.value, i = readDelimited(raw, i+1, '"', 0)
+		case c == '(':
+			token.kind = addressTokenComment
+			token.value, i = readDelimited(raw, i+1, ')', '(')
+			space = true
+		case c == '[':
+			token.kind = addressTokenLiteral
+			var literal string
+			literal, i = readDelimited(raw, i+1, ']', 0)
+			token.value = "[" + literal + "]"
+		case strings.IndexByte(addressSpecials, c) >= 0:
+			token.kind = addressTokenSpecial
+			token.value = raw[i : i+1]
+			i++
+		default:
+			token.kind = addressTokenAtom
+			end := i
+			for end < len(raw) && strings.IndexByte(addressSpecials+" \t\r\n", raw[end]) < 0 {
+				end++
+			}
+			// encoded-word may contain specials like '.' in Q encoding
+			if match := encodedWordRegexp.FindStringIndex(raw[i:]); match != nil && match[0] == 0 && match[1] > end-i {
+				end = i + match[1]
+			}
+			token.value, i = raw[i:end], end
+		}
+		token.end = i
+		tokens = append(tokens, token)
+	}
+	return
+}
+
+// readDelimited reads quoted string, comment or domain literal starting at
+// start and returns its content and position after closing delimiter.
+// Comments can be nested.
+func readDelimited(raw string, start int, closing, opening byte) (string, int) {
+	buf := &strings.Builder{}
+	depth := 0
+	for i := start; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && i+1 < len(raw):
+			i++
+			buf.WriteByte(raw[i])
+			continue
+		case c == closing && depth == 0:
+			return buf.String(), i + 1
+		case c == closing:
+			depth--
+		case opening != 0 && c == opening:
+			depth++
+		case c == '\r' || c == '\n':
+			// folding
+			continue
+		}
+		buf.WriteByte(c)
+	}
+	return buf.String(), len(raw)
+}
@@ -0,0 +1,97 @@
+package gomime
+
+import (
+	"net/mail"
+	"reflect"
+	"testing"
+)
+
+func TestParseAddressList(t *testing.T) {
+	testData := []struct {
+		raw       string
+		addresses []*mail.Address
+		groups    []string
+		unparsed  []string
+	}{
+		{
+			raw:       "john@example.com",
+			addresses: []*mail.Address{{Address: "john@example.com"}},
+		},
+		{
+			raw: `"Doe, John" <john@example.com>, Jane Roe <jane@example.com>`,
+			addresses: []*mail.Address{
+				{Name: "Doe, John", Address: "john@example.com"},
+				{Name: "Jane Roe", Address: "jane@example.com"},
+			},
+		},
+		{
+			raw: `"Semi; Colon" <semi@example.com>; Doe, John <john@example.com>`,
+			addresses: []*mail.Address{
+				{Name: "Semi; Colon", Address: "semi@example.com"},
+				{Name: "Doe, John", Address: "john@example.com"},
+			},
+		},
+		{
+			raw: "john@example.com (John Doe), Jane (the boss) <jane@example.com>",
+			addresses: []*mail.Address{
+				{Name: "John Doe", Address: "john@example.com"},
+				{Name: "Jane", Address: "jane@example.com"},
+			},
+		},
+		{
+			raw: "team: a@example.com, B <b@example.com>;, c@example.com, undisclosed-recipients:;",
+			addresses: []*mail.Address{
+				{Address: "a@example.com"},
+				{Name: "B", Address: "b@example.com"},
+				{Address: "c@example.com"},
+			},
+			groups: []string{"team: a@example.com b@example.com", "undisclosed-recipients:"},
+		},
+		{
+			raw:       "Route <@relay1.example.com,@relay2.example.com:john@example.com>",
+			addresses: []*mail.Address{{Name: "Route", Address: "john@example.com"}},
+		},
+		{
+			raw: `=?utf-8?q?J=C3=B6rg?= <jorg@example.com>, "=?utf-8?q?J=C3=B6rg?= M." <m@example.com>, Jörg <raw@example.com>`,
+			addresses: []*mail.Address{
+				{Name: "Jörg", Address: "jorg@example.com"},
+				{Name: "Jörg M.", Address: "m@example.com"},
+				{Name: "Jörg", Address: "raw@example.com"},
+			},
+		},
+		{
+			raw: `"john doe"@example.com, Ιωάννης <ιωάννης@παράδειγμα.ελ>, literal@[192.0.2.1]`,
+			addresses: []*mail.Address{
+				{Address: "john doe@example.com"},
+				{Name: "Ιωάννης", Address: "ιωάννης@παράδειγμα.ελ"},
+				{Address: "literal@[192.0.2.1]"},
+			},
+		},
+		{
+			raw:       "broken, john@example.com,, <>, also@, J. Q. Public <jqp@example.com>",
+			addresses: []*mail.Address{{Address: "john@example.com"}, {Name: "J. Q. Public", Address: "jqp@example.com"}},
+			unparsed:  []string{"broken", "<>", "also@"},
+		},
+	}
+
+	for _, val := range testData {
+		list := ParseAddressList(val.raw)
+		if !reflect.DeepEqual(list.Addresses, val.addresses) {
+			t.Errorf("%q: expected addresses %v but have %v", val.raw, val.addresses, list.Addresses)
+		}
+		var groups []string
+		for _, group := range list.Groups {
+			formatted := group.Name + ":"
+			for _, address := range group.Addresses {
+				formatted += " " + address.Address
+			}
+			groups = append(groups, formatted)
+		}
+		if !reflect.DeepEqual(groups, val.groups) {
+			t.Errorf("%q: expected groups %q but have %q", val.raw, val.groups, groups)
+		}
+		if !reflect.DeepEqual(list.Unparsed, val.unparsed) {
+			t.Errorf("%q: expected unparsed %q but have %q", val.raw, val.unparsed, list.Unparsed)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package gomime
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strconv"
+	"strings"
+)
+
+// Attachment holds attachment data together with information parsed from
+// its header.
+type Attachment struct {
+	// Filename is decoded from Content-Disposition filename or Content-Type
+	// name parameter.
+	Filename          string
+	MediaType         string
+	MediaTypeParams   map[string]string
+	Disposition       string
+	DispositionParams map[string]string
+	// ContentID is value of Content-ID header without angle brackets.
+	ContentID string
+	// DeclaredSize is size parameter of Content-Disposition, -1 when it is
+	// missing or invalid.
+	DeclaredSize int64
+	// Size is the actual size of Data.
+	Size int64
+	// Data are decoded from content transfer encoding. The charset is
+	// never converted.
+	Data   []byte
+	Header textproto.MIMEHeader
+
+	// text is content with charset converted to utf8, used by
+	// AttachmentsCollector for text attachments.
+	text []byte
+}
+
+// NewAttachment creates attachment from part header and data already
+// decoded from content transfer encoding.
+func NewAttachment(header textproto.MIMEHeader, data []byte) *Attachment {
+	a := &Attachment{
+		Data:         data,
+		Size:         int64(len(data)),
+		DeclaredSize: -1,
+		Header:       header,
+		ContentID:    strings.Trim(strings.TrimSpace(header.Get("Content-Id")), "<>"),
+	}
+	a.MediaType, a.MediaTypeParams, _ = getContentType(header)
+	a.Disposition, a.DispositionParams, _ = ParseMediaType(header.Get("Content-Disposition"))
+
+	if a.Filename = a.DispositionParams["filename"]; a.Filename == "" {
+		a.Filename = a.MediaTypeParams["name"]
+	}
+	if size, err := strconv.ParseInt(a.DispositionParams["size"], 10, 64); err == nil && size >= 0 {
+		a.DeclaredSize = size
+	}
+	return a
+}
+
+// Attachment reads part content and returns it as attachment.
+func (p *Part) Attachment() (*Attachment, error) {
+	data, err := ioutil.ReadAll(p.DecodedBody())
+	if err != nil {
+		return nil, err
+	}
+	return NewAttachment(p.Header, data), nil
+}
+
+// Reader returns reader of attachment data.
+func (a *Attachment) Reader() io.Reader {
+	return bytes.NewReader(a.Data)
+}
@@ -0,0 +1,87 @@
+package gomime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+const attachmentTestMessage = "Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"body\r\n" +
+	"--b\r\n" +
+	"Content-Type: application/pdf; charset=koi8-r; name=\"ignored.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Disposition: attachment; size=4;\r\n" +
+	" filename*=utf-8''%C5%BElu%C5%A5ou%C4%8Dk%C3%BD.pdf\r\n" +
+	"Content-ID: <pdf@example.com>\r\n" +
+	"\r\n" +
+	"wdrC1Q==\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain; charset=koi8-r; name=\"text.txt\"\r\n" +
+	"Content-Disposition: attachment\r\n" +
+	"\r\n" +
+	"\xc1\xda\xc2\xd5\xcb\xc1\r\n" +
+	"--b--\r\n"
+
+func TestAttachmentsCollectorAttachmentList(t *testing.T) {
+	mm, err := mail.ReadMessage(strings.NewReader(attachmentTestMessage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	collector := NewAttachmentsCollector(NewMIMEPrinter())
+	if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), NewMimeVisitor(collector)); err != nil {
+		t.Fatal("visit error", err)
+	}
+
+	attachments := collector.GetAttachmentList()
+	if len(attachments) != 2 {
+		t.Fatal("expected two attachments but have", len(attachments))
+	}
+
+	pdf := attachments[0]
+	if pdf.Filename != "žluťoučký.pdf" || pdf.MediaType != "application/pdf" || pdf.Disposition != "attachment" {
+		t.Errorf("unexpected attachment %q %v %v", pdf.Filename, pdf.MediaType, pdf.Disposition)
+	}
+	if pdf.ContentID != "pdf@example.com" || pdf.DeclaredSize != 4 || pdf.Size != 4 {
+		t.Errorf("unexpected content id %q or size %v/%v", pdf.ContentID, pdf.DeclaredSize, pdf.Size)
+	}
+	if !bytes.Equal(pdf.Data, []byte{0xc1, 0xda, 0xc2, 0xd5}) {
+		t.Errorf("binary data must not be converted but have %v", pdf.Data)
+	}
+	if data, _ := ioutil.ReadAll(pdf.Reader()); !bytes.Equal(data, pdf.Data) {
+		t.Error("reader returned different data", data)
+	}
+
+	text := attachments[1]
+	if text.Filename != "text.txt" || text.DeclaredSize != -1 || string(text.Data) != "\xc1\xda\xc2\xd5\xcb\xc1" {
+		t.Errorf("unexpected text attachment %q %v %q", text.Filename, text.DeclaredSize, text.Data)
+	}
+
+	if atts := collector.GetAttachments(); atts[0] != "\xc1\xda\xc2\xd5" || atts[1] != "азбука" {
+		t.Errorf("unexpected attachment contents %q", atts)
+	}
+	if headers := collector.GetAttHeaders(); !strings.Contains(headers[0], "Content-Id: <pdf@example.com>") {
+		t.Errorf("unexpected attachment headers %q", headers[0])
+	}
+}
+
+func TestPartAttachment(t *testing.T) {
+	root, err := Parse(strings.NewReader(attachmentTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	attachment, err := root.Children[1].Attachment()
+	if err != nil {
+		t.Fatal("attachment error", err)
+	}
+	if attachment.Filename != "žluťoučký.pdf" || !bytes.Equal(attachment.Data, []byte{0xc1, 0xda, 0xc2, 0xd5}) {
+		t.Errorf("unexpected attachment %q %v", attachment.Filename, attachment.Data)
+	}
+}
@@ -0,0 +1,376 @@
+package gomime
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxLineLength       = 998 // RFC 5322 limit without CRLF
+	foldLineLength      = 78  // RFC 5322 recommended line length
+	base64LineLength    = 76
+	boundaryRandomBytes = 16
+)
+
+type headerField struct {
+	key, value string
+}
+
+// builderPart is a node of composed message
+type builderPart struct {
+	mediaType string
+	params    map[string]string
+	header    []headerField
+	body      []byte
+	children  []*builderPart
+	// encoding is Content-Transfer-Encoding set by user, it is chosen by
+	// content when empty
+	encoding string
+}
+
+// MessageBuilder composes MIME message from text bodies, inline parts and
+// attachments and writes it with CRLF line endings. The structure is chosen
+// by content: multipart/alternative for plain text with HTML,
+// multipart/related for inline parts and multipart/mixed for attachments.
+type MessageBuilder struct {
+	header      []headerField
+	plainText   []byte
+	html        []byte
+	hasPlain    bool
+	hasHTML     bool
+	inlines     []*builderPart
+	attachments []*builderPart
+}
+
+// NewMessageBuilder returns empty builder
+func NewMessageBuilder() *MessageBuilder {
+	return &MessageBuilder{}
+}
+
+// SetHeader replaces all values of header key. Non-ASCII value, line breaks
+// and words longer than header line are encoded using EncodeHeader, or
+// EncodeAddressList for address headers. Content-Type and
+// Content-Transfer-Encoding replace the ones generated for the top-level
+// part, boundary of multipart is always generated. MIME-Version replaces the
+// generated one.
+func (mb *MessageBuilder) SetHeader(key, value string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	header := mb.header[:0]
+	for _, field := range mb.header {
+		if field.key != key {
+			header = append(header, field)
+		}
+	}
+	mb.header = header
+	mb.AddHeader(key, value)
+}
+
+// AddHeader adds header value. Non-ASCII value is encoded like in
+// SetHeader.
+func (mb *MessageBuilder) AddHeader(key, value string) {
+	mb.header = append(mb.header, headerField{textproto.CanonicalMIMEHeaderKey(key), encodeHeaderValue(key, value)})
+}
+
+// SetAddressHeader sets header key to the list of addresses. Only display
+// names are encoded.
+func (mb *MessageBuilder) SetAddressHeader(key string, addresses []*mail.Address) {
+	mb.SetHeader(key, EncodeAddressList(addresses))
+}
+
+// SetPlainText sets UTF-8 text/plain body
+func (mb *MessageBuilder) SetPlainText(body []byte) {
+	mb.plainText, mb.hasPlain = body, true
+}
+
+// SetHTML sets UTF-8 text/html body
+func (mb *MessageBuilder) SetHTML(body []byte) {
+	mb.html, mb.hasHTML = body, true
+}
+
+// AddInline adds part referenced from HTML body by contentID (without
+// angle brackets)
+func (mb *MessageBuilder) AddInline(contentID, mediaType, filename string, data []byte) {
+	part := newAttachmentPart("inline", mediaType, filename, data)
+	part.header = append(part.header, headerField{"Content-Id", "<" + contentID + ">"})
+	mb.inlines = append(mb.inlines, part)
+}
+
+// AddAttachment adds part with attachment disposition
+func (mb *MessageBuilder) AddAttachment(mediaType, filename string, data []byte) {
+	mb.attachments = append(mb.attachments, newAttachmentPart("attachment", mediaType, filename, data))
+}
+
+func newAttachmentPart(disposition, mediaType, filename string, data []byte) *builderPart {
+	part := &builderPart{mediaType: mediaType, params: map[string]string{}, body: data}
+	dispParams := map[string]string{}
+	if filename != "" {
+		part.params["name"] = filename
+		dispParams["filename"] = filename
+	}
+	part.header = []headerField{{"Content-Disposition", FormatMediaType(disposition, dispParams)}}
+	return part
+}
+
+func newTextPart(mediaType string, body []byte) *builderPart {
+	return &builderPart{mediaType: mediaType, params: map[string]string{"charset": "utf-8"}, body: body}
+}
+
+// newMultipart returns the only child or multipart with all children
+func newMultipart(mediaType string, children ...*builderPart) *builderPart {
+	if len(children) == 1 {
+		return children[0]
+	}
+	return &builderPart{mediaType: mediaType, params: map[string]string{}, children: children}
+}
+
+// root composes structure of message
+func (mb *MessageBuilder) root() *builderPart {
+	var bodies []*builderPart
+	if mb.hasPlain {
+		bodies = append(bodies, newTextPart("text/plain", mb.plainText))
+	}
+	if mb.hasHTML {
+		bodies = append(bodies, newTextPart("text/html", mb.html))
+	}
+
+	var mixed []*builderPart
+	if len(bodies) > 0 {
+		body := newMultipart("multipart/alternative", bodies...)
+		mixed = append(mixed, newMultipart("multipart/related", append([]*builderPart{body}, mb.inlines...)...))
+	} else {
+		mixed = append(mixed, mb.inlines...)
+	}
+	mixed = append(mixed, mb.attachments...)
+
+	if len(mixed) == 0 {
+		return newTextPart("text/plain", nil)
+	}
+	return newMultipart("multipart/mixed", mixed...)
+}
+
+// WriteTo writes composed message. It fails when content headers set by
+// user do not match the composed structure.
+func (mb *MessageBuilder) WriteTo(w io.Writer) (n int64, err error) {
+	root, hasVersion := mb.root(), false
+	buf := &bytes.Buffer{}
+	for _, field := range mb.header {
+		switch field.key {
+		case "Content-Type", "Content-Transfer-Encoding":
+			if root, err = root.withContentField(field.key, field.value); err != nil {
+				return
+			}
+			continue
+		case "Mime-Version":
+			hasVersion = true
+		}
+		writeHeaderField(buf, field.key, field.value)
+	}
+	if !hasVersion {
+		writeHeaderField(buf, "Mime-Version", "1.0")
+	}
+	if err = root.write(buf); err != nil {
+		return
+	}
+	// body of single part message ends with line break too
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\r\n")) {
+		buf.WriteString("\r\n")
+	}
+	return buf.WriteTo(w)
+}
+
+// withContentField returns copy of the part with content header field set
+// by user
+func (bp *builderPart) withContentField(key, value string) (*builderPart, error) {
+	part, isMultipart := *bp, len(bp.children) > 0
+	switch key {
+	case "Content-Type":
+		mediaType, params, err := ParseMediaType(value)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(mediaType, "multipart/") != isMultipart {
+			return nil, fmt.Errorf("gomime: Content-Type %v does not match composed %v", mediaType, bp.mediaType)
+		}
+		part.mediaType, part.params = mediaType, params
+	case "Content-Transfer-Encoding":
+		part.encoding = NormalizeTransferEncoding(value)
+		switch part.encoding {
+		case "7bit", "8bit", "binary":
+		case "quoted-printable", "base64":
+			if !isMultipart {
+				break
+			}
+			fallthrough
+		default:
+			return nil, fmt.Errorf("gomime: unsupported Content-Transfer-Encoding %v", value)
+		}
+	}
+	return &part, nil
+}
+
+func (bp *builderPart) write(buf *bytes.Buffer) (err error) {
+	if len(bp.children) > 0 {
+		var boundary string
+		if boundary, err = bp.uniqueBoundary(); err != nil {
+			return
+		}
+		bp.params["boundary"] = boundary
+		writeHeaderField(buf, "Content-Type", FormatMediaType(bp.mediaType, bp.params))
+		if bp.encoding != "" {
+			writeHeaderField(buf, "Content-Transfer-Encoding", bp.encoding)
+		}
+		bp.writeHeader(buf)
+		buf.WriteString("\r\n")
+		for _, child := range bp.children {
+			buf.WriteString("--" + boundary + "\r\n")
+			if err = child.write(buf); err != nil {
+				return
+			}
+			buf.WriteString("\r\n")
+		}
+		buf.WriteString("--" + boundary + "--\r\n")
+		return
+	}
+
+	encoding := bp.encoding
+	if encoding == "" {
+		encoding = chooseTransferEncoding(bp.body, strings.HasPrefix(bp.mediaType, "text/"))
+	}
+	writeHeaderField(buf, "Content-Type", FormatMediaType(bp.mediaType, bp.params))
+	writeHeaderField(buf, "Content-Transfer-Encoding", encoding)
+	bp.writeHeader(buf)
+	buf.WriteString("\r\n")
+	return writeEncodedBody(buf, bp.body, encoding)
+}
+
+func (bp *builderPart) writeHeader(buf *bytes.Buffer) {
+	for _, field := range bp.header {
+		writeHeaderField(buf, field.key, field.value)
+	}
+}
+
+// uniqueBoundary generates random boundary which does not occur in any
+// descendant body
+func (bp *builderPart) uniqueBoundary() (string, error) {
+	random := make([]byte, boundaryRandomBytes)
+	for {
+		if _, err := rand.Read(random); err != nil {
+			return "", err
+		}
+		boundary := "gomime-" + hex.EncodeToString(random)
+		if !bp.contains([]byte(boundary)) {
+			return boundary, nil
+		}
+	}
+}
+
+func (bp *builderPart) contains(b []byte) bool {
+	if bytes.Contains(bp.body, b) {
+		return true
+	}
+	for _, child := range bp.children {
+		if child.contains(b) {
+			return true
+		}
+	}
+	return false
+}
+
+// chooseTransferEncoding returns 7bit for short-lined ASCII text,
+// quoted-printable for mostly ASCII text and base64 otherwise
+func chooseTransferEncoding(data []byte, isText bool) string {
+	if !isText || !utf8.Valid(data) {
+		return "base64"
+	}
+	nonASCII, lineLength, longLines := 0, 0, false
+	for _, c := range data {
+		switch {
+		case c == '\n':
+			lineLength = 0
+			continue
+		case c >= 0x80 || c == 0 || (c < 0x20 && c != '\t' && c != '\r'):
+			nonASCII++
+		}
+		if lineLength++; lineLength > maxLineLength {
+			longLines = true
+		}
+	}
+	switch {
+	case nonASCII == 0 && !longLines:
+		return "7bit"
+	case nonASCII*3 <= len(data):
+		return "quoted-printable"
+	}
+	return "base64"
+}
+
+// writeEncodedBody writes data encoded by quoted-printable or base64, data
+// of identity encodings (7bit, 8bit, binary) only get CRLF line breaks
+func writeEncodedBody(buf *bytes.Buffer, data []byte, encoding string) (err error) {
+	switch encoding {
+	case "quoted-printable":
+		qp := quotedprintable.NewWriter(buf)
+		if _, err = qp.Write(data); err != nil {
+			return
+		}
+		err = qp.Close()
+	case "base64":
+		encoded := base64.StdEncoding.EncodeToString(data)
+		for len(encoded) > base64LineLength {
+			buf.WriteString(encoded[:base64LineLength] + "\r\n")
+			encoded = encoded[base64LineLength:]
+		}
+		buf.WriteString(encoded)
+	default:
+		buf.Write(toCRLF(data))
+	}
+	return
+}
+
+// toCRLF converts bare LF line endings to CRLF
+func toCRLF(data []byte) []byte {
+	return bytes.Replace(bytes.Replace(data, []byte("\r\n"), []byte("\n"), -1), []byte("\n"), []byte("\r\n"), -1)
+}
+
+// writeHeaderField writes header line folded before spaces to keep lines
+// shorter than 78 characters where possible. Lines with encoded-words are
+// kept within 76 characters, even by folding right after the key.
+func writeHeaderField(buf *bytes.Buffer, key, value string) {
+	line := key + ":"
+	value = " " + strings.TrimLeft(value, " ")
+	for len(value) > 0 {
+		segment := value
+		if next := strings.IndexByte(value[1:], ' '); next >= 0 {
+			segment = value[:next+1]
+		}
+		limit, isEncoded := foldLineLength, strings.Contains(line+segment, "=?")
+		if isEncoded {
+			limit = maxEncodedLineLength
+		}
+		if len(line)+len(segment) > limit && line != "" && (line != key+":" || isEncoded) {
+			buf.WriteString(line + "\r\n")
+			line = ""
+		}
+		line += segment
+		value = value[len(segment):]
+	}
+	buf.WriteString(line + "\r\n")
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
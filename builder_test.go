@@ -0,0 +1,188 @@
+package gomime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	attachment := []byte{0x00, 0xff, 0x10, 0x80}
+
+	mb := NewMessageBuilder()
+	mb.SetAddressHeader("From", []*mail.Address{{Name: "Jöhn Doe", Address: "john@example.com"}})
+	mb.SetHeader("Subject", "Příliš žluťoučký kůň úpěl ďábelské ódy, příliš žluťoučký kůň úpěl ďábelské ódy")
+	mb.SetPlainText([]byte("Hello\nwörld\n"))
+	mb.SetHTML([]byte("<p>Hello <img src=\"cid:logo\"></p>"))
+	mb.AddInline("logo", "image/png", "logo.png", []byte("png"))
+	mb.AddAttachment("application/octet-stream", "data.bin", attachment)
+
+	buf := &bytes.Buffer{}
+	if _, err := mb.WriteTo(buf); err != nil {
+		t.Fatal("write error", err)
+	}
+	if bytes.Contains(bytes.Replace(buf.Bytes(), []byte("\r\n"), nil, -1), []byte("\n")) {
+		t.Error("expected only CRLF line endings")
+	}
+
+	root, err := Parse(buf)
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if subject, _ := DecodeHeader(root.Header.Get("Subject")); subject != "Příliš žluťoučký kůň úpěl ďábelské ódy, příliš žluťoučký kůň úpěl ďábelské ódy" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if from, err := mail.ParseAddress(root.Header.Get("From")); err != nil || from.Name != "Jöhn Doe" {
+		t.Errorf("unexpected from %v: %v", from, err)
+	}
+
+	if root.MediaType != "multipart/mixed" || len(root.Children) != 2 {
+		t.Fatalf("unexpected root %v with %d children", root.MediaType, len(root.Children))
+	}
+	related := root.Children[0]
+	if related.MediaType != "multipart/related" || len(related.Children) != 2 {
+		t.Fatalf("unexpected related %v with %d children", related.MediaType, len(related.Children))
+	}
+	alternative := related.Children[0]
+	if alternative.MediaType != "multipart/alternative" || len(alternative.Children) != 2 {
+		t.Fatalf("unexpected alternative %v with %d children", alternative.MediaType, len(alternative.Children))
+	}
+
+	plain := alternative.Children[0]
+	if plain.TransferEncoding != "quoted-printable" {
+		t.Error("expected quoted-printable plain text but have", plain.TransferEncoding)
+	}
+	if decoded, _ := ioutil.ReadAll(plain.DecodedBody()); string(decoded) != "Hello\r\nwörld\r\n" {
+		t.Errorf("unexpected plain text %q", decoded)
+	}
+	if html := alternative.Children[1]; html.TransferEncoding != "7bit" {
+		t.Error("expected 7bit html but have", html.TransferEncoding)
+	}
+
+	inline := related.Children[1]
+	if inline.Header.Get("Content-Id") != "<logo>" || inline.Disposition != "inline" {
+		t.Errorf("unexpected inline part %v", inline.Header)
+	}
+
+	att := root.Children[1]
+	if att.TransferEncoding != "base64" || att.DispositionParams["filename"] != "data.bin" {
+		t.Errorf("unexpected attachment %v %v", att.TransferEncoding, att.DispositionParams)
+	}
+	if decoded, _ := ioutil.ReadAll(att.DecodedBody()); !bytes.Equal(decoded, attachment) {
+		t.Errorf("unexpected attachment data %v", decoded)
+	}
+}
+
+func TestMessageBuilderFoldsHeaders(t *testing.T) {
+	mb := NewMessageBuilder()
+	mb.SetHeader("References", strings.Repeat("<message-id@example.com> ", 10))
+	mb.SetPlainText([]byte("text"))
+
+	buf := &bytes.Buffer{}
+	if _, err := mb.WriteTo(buf); err != nil {
+		t.Fatal("write error", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > foldLineLength {
+			t.Errorf("line longer than %d: %q", foldLineLength, line)
+		}
+	}
+
+	root, err := Parse(buf)
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if references := strings.Fields(root.Header.Get("References")); len(references) != 10 {
+		t.Error("unexpected references", references)
+	}
+	if root.MediaType != "text/plain" || root.TransferEncoding != "7bit" {
+		t.Errorf("unexpected root %v %v", root.MediaType, root.TransferEncoding)
+	}
+}
+
+func TestMessageBuilderSinglePart(t *testing.T) {
+	mb := NewMessageBuilder()
+	mb.SetHeader("Subject", "single")
+	mb.SetHeader("Content-Type", "text/plain; charset=utf-8; format=flowed")
+	mb.SetHeader("Content-Transfer-Encoding", "base64")
+	mb.SetPlainText([]byte("no line break"))
+
+	buf := &bytes.Buffer{}
+	if _, err := mb.WriteTo(buf); err != nil {
+		t.Fatal("write error", err)
+	}
+	if !bytes.HasSuffix(buf.Bytes(), []byte("\r\n")) {
+		t.Errorf("expected CRLF at the end of %q", buf.String())
+	}
+	for _, key := range []string{"Content-Type:", "Content-Transfer-Encoding:", "Mime-Version:"} {
+		if count := strings.Count(buf.String(), key); count != 1 {
+			t.Errorf("expected one %v but have %d", key, count)
+		}
+	}
+
+	root, err := Parse(buf)
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if root.MediaTypeParams["format"] != "flowed" || root.TransferEncoding != "base64" {
+		t.Errorf("unexpected content headers %v", root.Header)
+	}
+	if decoded, _ := ioutil.ReadAll(root.DecodedBody()); string(decoded) != "no line break" {
+		t.Errorf("unexpected body %q", decoded)
+	}
+
+	mb.SetHeader("Content-Type", "multipart/mixed")
+	if _, err := mb.WriteTo(&bytes.Buffer{}); err == nil {
+		t.Error("expected error for Content-Type not matching structure")
+	}
+}
+
+func TestMessageBuilderHeaderInjection(t *testing.T) {
+	mb := NewMessageBuilder()
+	mb.SetHeader("Subject", "hi\r\nBcc: victim@example.com")
+	mb.AddHeader("X-Note", "a\nb")
+	mb.AddAttachment("application/octet-stream", "a.bin\r\nBcc: victim@example.com", nil)
+
+	buf := &bytes.Buffer{}
+	if _, err := mb.WriteTo(buf); err != nil {
+		t.Fatal("write error", err)
+	}
+	if strings.Contains(buf.String(), "\nBcc:") {
+		t.Fatalf("injected header field in %q", buf.String())
+	}
+	root, err := Parse(buf)
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if subject, _ := DecodeHeader(root.Header.Get("Subject")); subject != "hi\r\nBcc: victim@example.com" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+	if filename := root.DispositionParams["filename"]; filename != "a.bin\r\nBcc: victim@example.com" {
+		t.Errorf("unexpected filename %q", filename)
+	}
+}
+
+func TestMessageBuilderLongWord(t *testing.T) {
+	word := strings.Repeat("a", 2*maxLineLength)
+	mb := NewMessageBuilder()
+	mb.SetHeader("Subject", "long "+word)
+
+	buf := &bytes.Buffer{}
+	if _, err := mb.WriteTo(buf); err != nil {
+		t.Fatal("write error", err)
+	}
+	for _, line := range strings.Split(buf.String(), "\r\n") {
+		if len(line) > maxLineLength {
+			t.Fatalf("line longer than %d: %q", maxLineLength, line)
+		}
+	}
+	root, err := Parse(buf)
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if subject, _ := DecodeHeader(root.Header.Get("Subject")); subject != "long "+word {
+		t.Errorf("unexpected subject %q", subject)
+	}
+}
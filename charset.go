@@ -0,0 +1,168 @@
+package gomime
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// CharsetRegistry resolves charset names to encodings. Charsets and aliases
+// registered to it take precedence over charsets known to htmlindex, which
+// are found also by many aliases used in real mails. Names are case
+// insensitive. It is safe for concurrent use.
+type CharsetRegistry struct {
+	mu        sync.RWMutex
+	encodings map[string]encoding.Encoding
+	aliases   map[string]string
+}
+
+// DefaultCharsetRegistry is used by decoders and encoders of this package
+var DefaultCharsetRegistry = NewCharsetRegistry()
+
+// NewCharsetRegistry returns registry with charsets supported by default,
+// i.e. charsets of htmlindex, UTF-7, ISO-2022-KR and ISO-2022-CN.
+func NewCharsetRegistry() *CharsetRegistry {
+	r := &CharsetRegistry{
+		encodings: map[string]encoding.Encoding{},
+		aliases:   map[string]string{},
+	}
+	r.RegisterCharset("utf-7", UTF7)
+	r.RegisterAlias("utf7", "utf-7")
+	r.RegisterAlias("unicode-1-1-utf-7", "utf-7")
+	// htmlindex maps them to replacement encoding
+	r.RegisterCharset("iso-2022-kr", ISO2022KR)
+	r.RegisterAlias("csiso2022kr", "iso-2022-kr")
+	r.RegisterAlias("iso2022kr", "iso-2022-kr")
+	r.RegisterCharset("iso-2022-cn", ISO2022CN)
+	r.RegisterAlias("iso2022cn", "iso-2022-cn")
+	r.RegisterAlias("iso-2022-cn-ext", "iso-2022-cn")
+	return r
+}
+
+// RegisterCharset adds charset name to registry. It replaces previously
+// registered charset or alias of the same name.
+func (r *CharsetRegistry) RegisterCharset(name string, enc encoding.Encoding) {
+	name = charsetKey(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.aliases, name)
+	r.encodings[name] = enc
+}
+
+// RegisterAlias adds alias of canonical charset to registry. Canonical can
+// be registered charset, its alias or any charset known by default. It is
+// resolved on lookup, so the alias follows later registration of canonical.
+// Alias which would make a cycle is ignored.
+func (r *CharsetRegistry) RegisterAlias(alias, canonical string) {
+	alias, canonical = charsetKey(alias), charsetKey(canonical)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.resolveLocked(canonical) == alias {
+		return
+	}
+	delete(r.encodings, alias)
+	r.aliases[alias] = canonical
+}
+
+// Lookup returns encoding of charset
+func (r *CharsetRegistry) Lookup(charset string) (encoding.Encoding, error) {
+	_, enc, err := r.lookup(charset)
+	return enc, err
+}
+
+// mimePreferredNames are charsets which htmlindex decodes as windows-1252,
+// but which are encoded and labeled as themselves
+var mimePreferredNames = map[string]string{
+	"ascii":      "us-ascii",
+	"us-ascii":   "us-ascii",
+	"iso-8859-1": "iso-8859-1",
+}
+
+// Canonical returns MIME preferred name of charset label. It is the
+// registered name for registered charsets and their aliases, otherwise the
+// name defined by htmlindex except US-ASCII and ISO-8859-1. Content encoded
+// by EncodeCharset to the canonical name is the same as for the label.
+func (r *CharsetRegistry) Canonical(label string) (string, error) {
+	name, _, err := r.lookup(label)
+	if err != nil {
+		return "", err
+	}
+	if r.registered(label) == nil {
+		if preferred, ok := mimePreferredNames[normalizeCharset(r.resolve(label))]; ok {
+			return preferred, nil
+		}
+	}
+	return name, nil
+}
+
+// lookup returns encoding of charset label and name of charset used for
+// decoding
+func (r *CharsetRegistry) lookup(label string) (name string, enc encoding.Encoding, err error) {
+	name = r.resolve(label)
+	r.mu.RLock()
+	enc = r.encodings[name]
+	r.mu.RUnlock()
+	if enc != nil {
+		return name, enc, nil
+	}
+	preparsed := normalizeCharset(name)
+	if enc, _ = htmlindex.Get(preparsed); enc == nil {
+		return "", nil, fmt.Errorf("can not get encodig for '%s' (or '%s')", label, preparsed)
+	}
+	name, _ = htmlindex.Name(enc)
+	return name, enc, nil
+}
+
+// registered returns encoding registered to charset or its alias, nil for
+// other charsets
+func (r *CharsetRegistry) registered(charset string) encoding.Encoding {
+	name := r.resolve(charset)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.encodings[name]
+}
+
+// resolve returns key of charset with alias replaced by its canonical name
+func (r *CharsetRegistry) resolve(charset string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.resolveLocked(charsetKey(charset))
+}
+
+// resolveLocked follows aliases of charset key, the caller holds the lock
+func (r *CharsetRegistry) resolveLocked(name string) string {
+	// aliases make no cycle, the bound is just to be safe
+	for i := 0; i <= len(r.aliases); i++ {
+		canonical, ok := r.aliases[name]
+		if !ok {
+			break
+		}
+		name = canonical
+	}
+	return name
+}
+
+// charsetKey returns trimmed low case name of charset
+func charsetKey(charset string) string {
+	return strings.Trim(strings.ToLower(charset), " \t\r\n")
+}
+
+// CanonicalCharset returns canonical name of charset label as resolved by
+// DefaultCharsetRegistry, e.g. "koi8-r" for "csKOI8R" or "windows-1251" for
+// "cp1251". It fails for unknown charsets.
+func CanonicalCharset(label string) (string, error) {
+	return DefaultCharsetRegistry.Canonical(label)
+}
+
+// RegisterCharset adds charset to DefaultCharsetRegistry
+func RegisterCharset(name string, enc encoding.Encoding) {
+	DefaultCharsetRegistry.RegisterCharset(name, enc)
+}
+
+// RegisterAlias adds alias of charset to DefaultCharsetRegistry
+func RegisterAlias(alias, canonical string) {
+	DefaultCharsetRegistry.RegisterAlias(alias, canonical)
+}
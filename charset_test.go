@@ -0,0 +1,158 @@
+package gomime
+
+import (
+	"testing"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+func TestCharsetRegistry(t *testing.T) {
+	registry := NewCharsetRegistry()
+	registry.RegisterCharset("X-Mac-Cyrillic", charmap.MacintoshCyrillic)
+	registry.RegisterAlias("x-mac-ukrainian", "x-mac-cyrillic")
+	registry.RegisterAlias("mac-cyr", "X-MAC-UKRAINIAN")
+	registry.RegisterAlias("x-user-defined-cp", "CP1251")
+
+	windows1251, _ := htmlindex.Get("windows-1251")
+	testData := map[string]interface{}{
+		"x-mac-cyrillic":    charmap.MacintoshCyrillic,
+		" X-Mac-Ukrainian ": charmap.MacintoshCyrillic,
+		"mac-cyr":           charmap.MacintoshCyrillic,
+		"x-user-defined-cp": windows1251,
+		"utf7":              UTF7,
+		"koi8":              charmap.KOI8R,
+	}
+	for name, expected := range testData {
+		if enc, err := registry.Lookup(name); err != nil || enc != expected {
+			t.Errorf("%v: unexpected encoding %v, %v", name, enc, err)
+		}
+	}
+	if _, err := registry.Lookup("x-unknown"); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+	if _, err := DefaultCharsetRegistry.Lookup("x-user-defined-cp"); err == nil {
+		t.Error("default registry was changed")
+	}
+
+	// registered charset replaces alias
+	registry.RegisterCharset("mac-cyr", charmap.KOI8U)
+	if enc, _ := registry.Lookup("mac-cyr"); enc != charmap.KOI8U {
+		t.Errorf("unexpected encoding %v", enc)
+	}
+}
+
+func TestCharsetAliasFollowsRegistration(t *testing.T) {
+	registry := NewCharsetRegistry()
+	registry.RegisterCharset("x-vendor", charmap.MacintoshCyrillic)
+	registry.RegisterAlias("x-vendor-alias", "x-vendor")
+	registry.RegisterAlias("x-vendor-short", "x-vendor-alias")
+	registry.RegisterAlias("x-vendor", "x-vendor-short")
+
+	registry.RegisterCharset("x-vendor", charmap.KOI8R)
+	if enc, err := registry.Lookup("x-vendor-short"); err != nil || enc != charmap.KOI8R {
+		t.Errorf("expected re-registered charset but have %v, %v", enc, err)
+	}
+	registry.RegisterCharset("x-vendor-alias", charmap.Windows1251)
+	if enc, err := registry.Lookup("x-vendor-short"); err != nil || enc != charmap.Windows1251 {
+		t.Errorf("expected charset registered to alias but have %v, %v", enc, err)
+	}
+}
+
+func TestRegisteredCharsetIsUsed(t *testing.T) {
+	// registrations must not leak to other tests
+	defaultRegistry := DefaultCharsetRegistry
+	DefaultCharsetRegistry = NewCharsetRegistry()
+	defer func() { DefaultCharsetRegistry = defaultRegistry }()
+
+	RegisterCharset("x-test-mac-cyrillic", charmap.MacintoshCyrillic)
+	RegisterAlias("x-test-mac-cyr", "x-test-mac-cyrillic")
+
+	// "Привет" in Mac Cyrillic
+	encoded := "\x8f\xf0\xe8\xe2\xe5\xf2"
+	if decoded, err := DecodeCharset([]byte(encoded), "text/plain", map[string]string{"charset": "x-test-mac-cyr"}); err != nil || string(decoded) != "Привет" {
+		t.Errorf("unexpected decoded text %q, %v", decoded, err)
+	}
+	if decoded, err := DecodeHeader("=?x-test-mac-cyrillic?q?=8F=F0=E8=E2=E5=F2?="); err != nil || decoded != "Привет" {
+		t.Errorf("unexpected decoded header %q, %v", decoded, err)
+	}
+	if encoded, err := EncodeCharset([]byte("Привет"), "x-test-mac-cyr"); err != nil || string(encoded) != "\x8f\xf0\xe8\xe2\xe5\xf2" {
+		t.Errorf("unexpected encoded text %q, %v", encoded, err)
+	}
+}
+
+func TestCanonicalCharset(t *testing.T) {
+	testData := map[string]string{
+		"UTF-8":              "utf-8",
+		"utf8mb4":            "utf-8",
+		"csKOI8R":            "koi8-r",
+		"koi8u":              "koi8-u",
+		"cp1251":             "windows-1251",
+		"Win-1250":           "windows-1250",
+		"ISO_8859-2":         "iso-8859-2",
+		"iso-8859-8-i":       "iso-8859-8-i",
+		"latin1":             "iso-8859-1",
+		"ISO-8859-1":         "iso-8859-1",
+		"l9":                 "iso-8859-15",
+		"us-ascii":           "us-ascii",
+		"ANSI_X3.4-1968":     "us-ascii",
+		"windows-1252":       "windows-1252",
+		"csiso2022jp":        "iso-2022-jp",
+		"cp949":              "euc-kr",
+		" Unicode-1-1-UTF-7": "utf-7",
+	}
+	for label, expected := range testData {
+		if canonical, err := CanonicalCharset(label); err != nil || canonical != expected {
+			t.Errorf("%q: expected %q but have %q, %v", label, expected, canonical, err)
+		}
+	}
+	for _, label := range []string{"", "x-unknown", "cp9999", "iso-8859-99"} {
+		if canonical, err := CanonicalCharset(label); err == nil {
+			t.Errorf("%q: expected error but have %q", label, canonical)
+		}
+	}
+
+	// composer can label and encode mail by canonical name
+	for _, label := range []string{"latin1", "us-ascii", "cp1252", "koi8", "utf7", "iso_8859-2"} {
+		canonical, _ := CanonicalCharset(label)
+		for _, text := range []string{"plain", "café", "€", "Привет", "Žluťoučký"} {
+			expected, expectedErr := EncodeCharset([]byte(text), label)
+			encoded, err := EncodeCharset([]byte(text), canonical)
+			if string(encoded) != string(expected) || (err == nil) != (expectedErr == nil) {
+				t.Errorf("%q: %v and %v encode %q differently: %q, %v and %q, %v", text, label, canonical, text, expected, expectedErr, encoded, err)
+			}
+		}
+	}
+
+	registry := NewCharsetRegistry()
+	registry.RegisterCharset("x-vendor-cyrillic", charmap.MacintoshCyrillic)
+	registry.RegisterAlias("x-vendor-cyr", "x-vendor-cyrillic")
+	if canonical, err := registry.Canonical("X-Vendor-Cyr"); err != nil || canonical != "x-vendor-cyrillic" {
+		t.Errorf("unexpected canonical name %q, %v", canonical, err)
+	}
+}
+
+var benchmarkCharsetLabels = []string{"utf-8", "UTF-8", "iso-8859-1", "windows-1252", "koi8-r", "cp1251", "latin2", "gb2312", "x-unknown"}
+
+func BenchmarkCanonicalCharset(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		for _, label := range benchmarkCharsetLabels {
+			_, _ = CanonicalCharset(label)
+		}
+	}
+}
+
+func BenchmarkCanonicalCharsetUTF8(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		_, _ = CanonicalCharset("utf-8")
+	}
+}
+
+func BenchmarkDecodeHeaderEncodedWords(b *testing.B) {
+	header := "=?iso-8859-2?q?P=F8=EDli=B9?= =?koi8-r?b?8NLJ18XU?= =?UTF-8?q?caf=C3=A9?="
+	for i := 0; i < b.N; i++ {
+		if _, err := DecodeHeader(header); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package gomime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+// DecodePolicy tells decoder what to do with byte sequences which are not
+// valid in the charset
+type DecodePolicy int
+
+const (
+	// DecodeStrict fails with InvalidSequenceError
+	DecodeStrict DecodePolicy = iota
+	// DecodeReplace replaces each invalid sequence with U+FFFD
+	DecodeReplace
+	// DecodeBestEffort replaces invalid sequences like DecodeReplace and
+	// never fails. Text in unknown charset or without charset is decoded by
+	// charset guessed by DetectCharset, otherwise as UTF-8.
+	DecodeBestEffort
+)
+
+// InvalidSequenceError is returned for content which is not valid in its
+// charset
+type InvalidSequenceError struct {
+	Charset string
+}
+
+func (e *InvalidSequenceError) Error() string {
+	return fmt.Sprintf("gomime: invalid byte sequence in %v", e.Charset)
+}
+
+// DecodeResult is content decoded by DecodeCharsetWithPolicy
+type DecodeResult struct {
+	Data []byte
+	// Charset used for decoding. It is the detected charset or "utf-8"
+	// when declared charset was missing or unknown, empty for content
+	// which was not decoded.
+	Charset string
+	// Invalid is number of invalid bytes or byte sequences which were
+	// replaced by U+FFFD
+	Invalid int
+}
+
+// DecodeCharsetWithPolicy decodes the original using content type
+// parameters like DecodeCharset. Content which is not valid in the charset
+// is handled by policy.
+func DecodeCharsetWithPolicy(original []byte, mediaType string, contentTypeParams map[string]string, policy DecodePolicy) (result *DecodeResult, err error) {
+	charset, ok := contentTypeParams["charset"]
+	if !ok {
+		if !strings.HasPrefix(mediaType, "text/") {
+			return &DecodeResult{Data: original}, nil
+		}
+		if isPlainUTF8(original) {
+			return &DecodeResult{Data: original, Charset: "utf-8"}, nil
+		}
+		if charset = guessCharset(original); charset == "" {
+			if policy != DecodeBestEffort {
+				return nil, fmt.Errorf("non-utf8 content without charset specification")
+			}
+			charset = "utf-8"
+		}
+	}
+
+	pd, err := newPolicyDecoder(charset, policy)
+	if err != nil {
+		if policy != DecodeBestEffort {
+			return nil, err
+		}
+		if charset = guessCharset(original); charset == "" {
+			charset = "utf-8"
+		}
+		if pd, err = newPolicyDecoder(charset, policy); err != nil {
+			return nil, err
+		}
+	}
+
+	data, _, err := transform.Bytes(pd, original)
+	if err != nil {
+		return nil, err
+	}
+	return &DecodeResult{Data: data, Charset: charset, Invalid: pd.invalid}, nil
+}
+
+// guessCharset returns charset detected confidently enough
+func guessCharset(data []byte) string {
+	if charset, confidence := DetectCharset(data); confidence >= minDetectConfidence {
+		return charset
+	}
+	return ""
+}
+
+// decodeWithPolicy decodes data in charset by policy
+func decodeWithPolicy(data []byte, charset string, policy DecodePolicy) (decoded []byte, invalid int, err error) {
+	pd, err := newPolicyDecoder(charset, policy)
+	if err != nil {
+		return nil, 0, err
+	}
+	if decoded, _, err = transform.Bytes(pd, data); err != nil {
+		return nil, 0, err
+	}
+	return decoded, pd.invalid, nil
+}
+
+// replacementRune is written instead of invalid sequences
+var replacementRune = []byte(string(utf8.RuneError))
+
+// policyDecoder applies DecodePolicy on content decoded by decoder. Charset
+// decoders of x/text replace invalid sequences themselves, so U+FFFD in
+// their output is counted as invalid sequence. Decoders which fail on
+// invalid sequence (e.g. UTF-7) are restarted after the invalid byte.
+type policyDecoder struct {
+	decoder transform.Transformer
+	charset string
+	policy  DecodePolicy
+	// countReplacements is false for decoders which fail on all invalid
+	// sequences, U+FFFD in their output was valid input
+	countReplacements bool
+	invalid           int
+}
+
+func newPolicyDecoder(charset string, policy DecodePolicy) (*policyDecoder, error) {
+	enc, err := getEncoding(charset)
+	if err != nil {
+		return nil, err
+	}
+	pd := &policyDecoder{charset: charset, policy: policy}
+	if enc == unicode.UTF8 {
+		pd.decoder = utf8Validator{}
+	} else {
+		pd.decoder, pd.countReplacements = enc.NewDecoder(), true
+	}
+	return pd, nil
+}
+
+func (pd *policyDecoder) Reset() {
+	pd.decoder.Reset()
+	pd.invalid = 0
+}
+
+func (pd *policyDecoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for {
+		var n, m int
+		n, m, err = pd.decoder.Transform(dst[nDst:], src[nSrc:], atEOF)
+		if pd.countReplacements {
+			if replaced := bytes.Count(dst[nDst:nDst+n], replacementRune); replaced > 0 {
+				if pd.policy == DecodeStrict {
+					return nDst, nSrc, &InvalidSequenceError{Charset: pd.charset}
+				}
+				pd.invalid += replaced
+			}
+		}
+		nDst, nSrc = nDst+n, nSrc+m
+		if err == nil || err == transform.ErrShortDst || err == transform.ErrShortSrc {
+			return
+		}
+
+		// the decoder stops at invalid sequence
+		if pd.policy == DecodeStrict {
+			return nDst, nSrc, &InvalidSequenceError{Charset: pd.charset}
+		}
+		if len(dst)-nDst < len(replacementRune) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], replacementRune)
+		if nSrc < len(src) {
+			nSrc++
+		}
+		pd.decoder.Reset()
+		pd.invalid++
+		if nSrc == len(src) {
+			return nDst, nSrc, nil
+		}
+	}
+}
+
+// errInvalidUTF8 is returned by utf8Validator
+var errInvalidUTF8 = errors.New("gomime: invalid utf-8")
+
+// utf8Validator copies valid UTF-8 and fails on invalid bytes
+type utf8Validator struct {
+	transform.NopResetter
+}
+
+func (utf8Validator) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		size := 1
+		if src[nSrc] >= utf8.RuneSelf {
+			if !utf8.FullRune(src[nSrc:]) && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			var r rune
+			if r, size = utf8.DecodeRune(src[nSrc:]); r == utf8.RuneError && size == 1 {
+				return nDst, nSrc, errInvalidUTF8
+			}
+		}
+		if len(dst)-nDst < size {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		nDst += copy(dst[nDst:], src[nSrc:nSrc+size])
+		nSrc += size
+	}
+	return
+}
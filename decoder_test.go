@@ -0,0 +1,91 @@
+package gomime
+
+import (
+	"testing"
+)
+
+func TestDecodeCharsetWithPolicy(t *testing.T) {
+	testData := []struct {
+		original string
+		params   map[string]string
+		policy   DecodePolicy
+		decoded  string
+		charset  string
+		invalid  int
+	}{
+		{"caf\xc3\xa9", map[string]string{"charset": "utf-8"}, DecodeStrict, "café", "utf-8", 0},
+		// valid U+FFFD is not counted
+		{"\xef\xbf\xbd", map[string]string{"charset": "utf-8"}, DecodeStrict, "�", "utf-8", 0},
+		{"caf\xe9 \xff", map[string]string{"charset": "utf-8"}, DecodeReplace, "caf� �", "utf-8", 2},
+		// undefined byte of windows-1253
+		{"\xe1\xaa", map[string]string{"charset": "windows-1253"}, DecodeReplace, "α�", "windows-1253", 1},
+		// stateful decoder continues after invalid sequence
+		{"a+2D3-b", map[string]string{"charset": "utf-7"}, DecodeReplace, "a�b", "utf-7", 1},
+		{"Hi +Jjo-", map[string]string{"charset": "utf-7"}, DecodeStrict, "Hi ☺", "utf-7", 0},
+		// best effort uses detection or utf-8 instead of unknown charset
+		{string(encodeTestText(t, detectRussian, "koi8-r")), map[string]string{"charset": "x-unknown"}, DecodeBestEffort, detectRussian, "koi8-r", 0},
+		{"caf\xe9", map[string]string{"charset": "x-unknown"}, DecodeBestEffort, "café", "windows-1252", 0},
+		{"\x81\x8d\x8f\x90\x9d", map[string]string{}, DecodeBestEffort, "�����", "utf-8", 5},
+	}
+	for _, val := range testData {
+		result, err := DecodeCharsetWithPolicy([]byte(val.original), "text/plain", val.params, val.policy)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", val.original, err)
+			continue
+		}
+		if string(result.Data) != val.decoded || result.Charset != val.charset || result.Invalid != val.invalid {
+			t.Errorf("%q: expected %q in %v (%d invalid) but have %q in %v (%d invalid)", val.original, val.decoded, val.charset, val.invalid, result.Data, result.Charset, result.Invalid)
+		}
+	}
+
+	failing := []struct {
+		original string
+		params   map[string]string
+		policy   DecodePolicy
+	}{
+		{"caf\xe9", map[string]string{"charset": "utf-8"}, DecodeStrict},
+		{"\xe1\xaa", map[string]string{"charset": "windows-1253"}, DecodeStrict},
+		{"a+2D3-b", map[string]string{"charset": "utf-7"}, DecodeStrict},
+		{"text", map[string]string{"charset": "x-unknown"}, DecodeReplace},
+		{"\x81\x8d\x8f\x90\x9d", map[string]string{}, DecodeReplace},
+	}
+	for _, val := range failing {
+		if result, err := DecodeCharsetWithPolicy([]byte(val.original), "text/plain", val.params, val.policy); err == nil {
+			t.Errorf("%q: expected error but have %q", val.original, result.Data)
+		}
+	}
+
+	// binary content is not touched
+	if result, err := DecodeCharsetWithPolicy([]byte("\xff"), "image/png", map[string]string{}, DecodeStrict); err != nil || string(result.Data) != "\xff" || result.Charset != "" {
+		t.Errorf("binary content was changed %v", err)
+	}
+}
+
+func TestDecodeHeaderWithPolicy(t *testing.T) {
+	testData := []struct {
+		raw     string
+		policy  DecodePolicy
+		decoded string
+		invalid int
+	}{
+		{"=?utf-8?q?caf=C3=A9?= =?utf-8?q?_bar?=", DecodeStrict, "café bar", 0},
+		{"=?utf-8?q?caf=E9?= bar", DecodeReplace, "caf� bar", 1},
+		{"raw caf\xe9", DecodeReplace, "raw caf�", 1},
+		{"=?x-unknown?q?abc?= =?utf-8?q?d=C3=A9f?=", DecodeBestEffort, "=?x-unknown?q?abc?= déf", 3},
+	}
+	for _, val := range testData {
+		decoded, invalid, err := DecodeHeaderWithPolicy(val.raw, val.policy)
+		if err != nil || decoded != val.decoded || invalid != val.invalid {
+			t.Errorf("%q: expected %q (%d invalid) but have %q (%d invalid), %v", val.raw, val.decoded, val.invalid, decoded, invalid, err)
+		}
+	}
+
+	for _, raw := range []string{"=?utf-8?q?caf=E9?=", "=?x-unknown?q?abc?="} {
+		if _, _, err := DecodeHeaderWithPolicy(raw, DecodeStrict); err == nil {
+			t.Errorf("%q: expected error", raw)
+		}
+	}
+	if _, _, err := DecodeHeaderWithPolicy("=?x-unknown?q?abc?=", DecodeReplace); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+}
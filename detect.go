@@ -0,0 +1,275 @@
+package gomime
+
+import (
+	"bytes"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// detectSampleSize limits data used by DetectCharset
+	detectSampleSize = 64 << 10
+	// minDetectConfidence is required by DecodeCharset to use detected
+	// charset
+	minDetectConfidence = 0.3
+)
+
+// Frequent characters of languages, the models treat them as evidence of
+// correct decoding
+var (
+	frequentRussian = runeSet("оеаинтсрвлкмдпуяызьбгч")
+	frequentChinese = runeSet("的一是不了在人有我他这个们中来上大为和国地到以说时要就出会可也你对生能而子那得于着下自之年过发后作里用道行所然家种事成方多经么去法学如都同现当没动面起看定天分还进好小部其些主样理心她本前开但因只从想实日军者意无力它与长把机十民第公此已工使情明性知全三又关点正业外将两高间由问很最重并物手应战向头文体政美相见被利什二等产或新己制身果加西斯月话合回特代内信表化老给世位次度门任常先海通教儿原东声提立及比员解水名真论处走义各入几口认条平系气题活尔更别打女变四神总何电数安少报才结反受目太量再感建务做接必场件计管期市直德资命山金指克许统区保至队形社便空决治展马科司五基眼书非则听白却界达光放强即像难且权思王象完设式色路记南品住告类求据程北边死张该交规万取拉格望觉术领共确传师观清今切院让识候带导争运笑飞风步改收根干造言联持组每济车亲极林服快办议往元英士证近失转夫令准布始怎呢存未远叫台单影具罗字爱击流备兵连调深商算质团集百需价花党华城石级整府离况亚请技际约示复病息究线似官火断精满支视消越器容照须九增研写称企八功吗包片史委乎查轻易早曾除农找装广显吧阿李标谈吃图念六引历首医局突专费号尽另周较注语仅考落青随选列武红响虽推势参希古众构房半节土投某案黑维革划敌致陈律足态护七兴派孩验责营星够章音跟志底站严巴例防族供效续施留讲型料终答紧黄绝奇察母京段依批群项故按河米围江织害斗双境客纪采举杀攻父苏密低朝友诉止细愿千值仍男钱破网热助倒育属坐帝限船脸职速刻乐否刚威毛状率甚独球般普怕弹校苦创假久错承印晚兰试股拿脑预谁益阳若哪微尼继送急血惊伤素药适波夜省初喜卫源食险待述陆习置居劳财环排福纳欢雷警获模充负云停木游龙树疑层冷洲冲射略范竟句室异激汉村哈策演简卡罪判担州静退既衣您宗积余痛检差富灵协角占配征修皮挥胜降阶审沉坚善妈刘读啊超免压银买皇养伊怀执副乱抗犯追帮宣佛岁航优怪香著田铁控税左右份穿艺背阵草脚概恶块顿敢守酒岛托央户烈洋哥索胡款靠评版宝座释景顾弟登货互付伯慢欧换闻危忙核暗姐介坏讨丽良序升监临亮露永呼味野架域沙掉括舰鱼杂误湾吉减编楚肯测败屋跑梦散温困剑渐封救贵枪缺楼县尚毫移娘朋画班智亦耳恩短掌恐遗固席松秘谢鲁遇康虑幸均销钟诗藏赶剧票损忽巨炮旧端探湖录叶春乡附吸予礼港雨呀板庭妇归睛饭额含顺输摇招婚脱补谓督毒油疗旅泽材灭逐莫笔亡鲜词圣择寻厂睡博勒烟授诺伦岸奥唐卖俄炸载洛健堂旁宫喝借君禁阴园谋宋避抓荣姑孙逃牙束跳顶玉镇雪午练迫爷篇肉嘴馆遍凡础洞卷坦牛宁纸诸训私庄祖丝翻暴森塔默握戏隐熟骨访弱蒙歌店鬼软典欲萨伙遭盘爸扩盖弄雄稳忘亿刺拥徒姆杨齐赛趣曲刀床迎冰虚玩析窗醒妻透购替塞努休虎扬途侵刑绿兄迅套贸毕唯谷轮库迹尤竞街促延震弃甲伟麻川申缓潜闪售灯针哲络抵朱埃抱鼓植纯夏忍页杰筑折郑贝尊吴秀混臣雅振染盛怒舞圆搞狂措姓残秋培迷诚宽宇猛摆梅毁伸摩盟末乃悲拍丁赵映侧尺遥暂厚")
+	frequentKorean  = runeSet("이다는의에가을고하지한서기로도사리자어니게대수아시정요인해나있들보일으거습부라만적것제상전주구마그스우여국비러면성동신문원소경과없장내히네할데까생화위안오세조무모선식당저방분미바물중말연통발개실학회계공드입트려께행했결확십님감사합니까드립")
+)
+
+func runeSet(s string) map[rune]bool {
+	set := map[rune]bool{}
+	for _, r := range s {
+		set[r] = true
+	}
+	return set
+}
+
+// charsetModel scores text decoded by charset. The score is average weight
+// of non-ASCII characters.
+type charsetModel struct {
+	charset string
+	weight  func(r, prev, next rune) float64
+}
+
+var charsetModels = []charsetModel{
+	{"windows-1251", russianWeight},
+	{"koi8-r", russianWeight},
+	{"gbk", chineseWeight},
+	{"shift_jis", japaneseWeight},
+	{"euc-jp", japaneseWeight},
+	{"euc-kr", koreanWeight},
+	{"windows-1252", latinWeight},
+}
+
+func isCJKPunct(r rune) bool {
+	return (r >= 0x3000 && r <= 0x303f) || (r >= 0xff00 && r <= 0xffef)
+}
+
+func isASCIILetter(r rune) bool {
+	return r < utf8.RuneSelf && unicode.IsLetter(r)
+}
+
+func isRussianLetter(r rune) bool {
+	return (r >= 'А' && r <= 'я') || r == 'ё' || r == 'Ё'
+}
+
+func russianWeight(r, prev, next rune) float64 {
+	if !unicode.Is(unicode.Cyrillic, r) {
+		return 0
+	}
+	weight := 0.3
+	switch {
+	case !isRussianLetter(r):
+		weight = 0.1
+	case frequentRussian[r]:
+		weight = 1
+	case unicode.IsLower(r):
+		weight = 0.5
+	}
+	// Cyrillic letters are not mixed with Latin in one word and capital
+	// letters do not follow small ones
+	if isASCIILetter(prev) || isASCIILetter(next) || (unicode.IsUpper(r) && unicode.IsLower(prev)) {
+		weight *= 0.1
+	}
+	return weight
+}
+
+func chineseWeight(r, prev, next rune) float64 {
+	switch {
+	case frequentChinese[r]:
+		return 1
+	case unicode.Is(unicode.Han, r):
+		return 0.4
+	case isCJKPunct(r):
+		return 0.5
+	}
+	return 0
+}
+
+func japaneseWeight(r, prev, next rune) float64 {
+	switch {
+	case unicode.Is(unicode.Hiragana, r):
+		return 1
+	case unicode.Is(unicode.Katakana, r):
+		return 0.8
+	case unicode.Is(unicode.Han, r):
+		return 0.4
+	case isCJKPunct(r):
+		return 0.5
+	}
+	return 0
+}
+
+func koreanWeight(r, prev, next rune) float64 {
+	switch {
+	case frequentKorean[r]:
+		return 1
+	case r >= 0xac00 && r <= 0xd7a3: // Hangul syllables
+		return 0.3
+	case unicode.Is(unicode.Han, r):
+		return 0.2
+	case isCJKPunct(r):
+		return 0.5
+	}
+	return 0
+}
+
+func latinWeight(r, prev, next rune) float64 {
+	switch {
+	case unicode.Is(unicode.Latin, r):
+		return 1
+	case unicode.IsPrint(r):
+		return 0.5
+	}
+	return 0
+}
+
+// score returns how well text decoded by charset of the model looks like
+// the language of the model
+func (m charsetModel) score(data []byte) float64 {
+	decoder, err := selectDecoder(m.charset)
+	if err != nil {
+		return 0
+	}
+	decoded, err := decoder.Bytes(data)
+	if err != nil {
+		return 0
+	}
+
+	runes := bytes.Runes(decoded)
+	sum, nonASCII, invalid := 0.0, 0, 0
+	for i, r := range runes {
+		if r < utf8.RuneSelf {
+			continue
+		}
+		nonASCII++
+		if r == utf8.RuneError {
+			invalid++
+			continue
+		}
+		var prev, next rune
+		if i > 0 {
+			prev = runes[i-1]
+		}
+		if i+1 < len(runes) {
+			next = runes[i+1]
+		}
+		sum += m.weight(r, prev, next)
+	}
+	if nonASCII == 0 {
+		return 0
+	}
+	score := sum / float64(nonASCII)
+	// invalid sequences are strong evidence of wrong charset
+	if score *= 1 - 10*float64(invalid)/float64(nonASCII); score < 0 {
+		return 0
+	}
+	// Western text is mostly ASCII while text in other scripts is not
+	if m.charset == "windows-1252" {
+		score *= 1 - float64(nonASCII)/float64(len(runes))
+	}
+	return score
+}
+
+// DetectCharset returns guessed charset of text with confidence between 0
+// (no idea) and 1 (sure). BOM, ISO-2022 escapes and UTF-8 are recognized,
+// legacy charsets are guessed by frequency of characters.
+func DetectCharset(data []byte) (charset string, confidence float64) {
+	switch {
+	case bytes.HasPrefix(data, []byte("\xef\xbb\xbf")):
+		return "utf-8", 1
+	case bytes.HasPrefix(data, []byte("\xfe\xff")):
+		return "utf-16be", 1
+	case bytes.HasPrefix(data, []byte("\xff\xfe")):
+		return "utf-16le", 1
+	}
+
+	if len(data) > detectSampleSize {
+		data = trimIncompleteRune(data[:detectSampleSize])
+	}
+
+	isASCII := true
+	for _, c := range data {
+		if c >= utf8.RuneSelf {
+			isASCII = false
+			break
+		}
+	}
+	switch {
+	case bytes.Contains(data, []byte("\x1b$B")) || bytes.Contains(data, []byte("\x1b$@")):
+		return "iso-2022-jp", 1
+	case bytes.Contains(data, []byte("\x1b$)C")):
+		return "iso-2022-kr", 1
+	case bytes.Contains(data, []byte("\x1b$)A")) || bytes.Contains(data, []byte("\x1b$)G")):
+		return "iso-2022-cn", 1
+	case isASCII:
+		return "us-ascii", 1
+	case utf8.Valid(data):
+		return "utf-8", 0.9
+	}
+
+	best, second := 0.0, 0.0
+	for _, model := range charsetModels {
+		score := model.score(data)
+		switch {
+		case score > best:
+			charset, best, second = model.charset, score, best
+		case score > second:
+			second = score
+		}
+	}
+	if confidence = best - second/2; confidence < 0 {
+		confidence = 0
+	}
+	return charset, confidence
+}
+
+// isPlainUTF8 returns true for valid UTF-8 text which does not contain
+// escape sequences of 7-bit ISO-2022 charsets
+func isPlainUTF8(data []byte) bool {
+	return utf8.Valid(data) && bytes.IndexByte(data, iso2022Escape) < 0
+}
+
+// detectCharsetMismatch returns charset detected in text which is clearly
+// different from declared charset
+func detectCharsetMismatch(data []byte, declared string) (detected string, mismatch bool) {
+	name, _, err := DefaultCharsetRegistry.lookup(declared)
+	if err != nil {
+		return "", false
+	}
+	// detection can not recognize UTF-16 without BOM and UTF-8 is never
+	// wrong for valid UTF-8 text
+	if name == "utf-8" || strings.HasPrefix(name, "utf-16") {
+		return "", false
+	}
+
+	detected, confidence := DetectCharset(data)
+	if detected == "us-ascii" || confidence < 0.5 {
+		return "", false
+	}
+	declaredModel, detectedModel := findCharsetModel(name), findCharsetModel(detected)
+	if declaredModel == nil || detectedModel == nil {
+		// detected by BOM, escape sequences or UTF-8 validity
+		return detected, detectedModel == nil && name != detected
+	}
+	if declaredModel == detectedModel {
+		return "", false
+	}
+	return detected, declaredModel.score(data) < detectedModel.score(data)/2
+}
+
+func findCharsetModel(charset string) *charsetModel {
+	for i := range charsetModels {
+		if charsetModels[i].charset == charset {
+			return &charsetModels[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package gomime
+
+import (
+	"bytes"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+const (
+	detectRussian  = "Привет! Это письмо отправлено без указания кодировки, поэтому почтовый клиент должен угадать её сам."
+	detectChinese  = "你好，这封邮件没有指定字符集，所以邮件客户端需要自己判断文本的编码。我们明天下午三点在公司开会。"
+	detectJapanese = "こんにちは。このメールには文字コードの指定がありませんので、メールソフトが自動的に判定する必要があります。"
+	detectKorean   = "안녕하세요. 이 메일에는 문자 집합이 지정되어 있지 않으므로 메일 프로그램이 직접 인코딩을 판단해야 합니다."
+	detectLatin    = "Grüße aus München! Das Café öffnet am Wochenende später, wir treffen uns also erst gegen elf Uhr."
+)
+
+func encodeTestText(t *testing.T, text, charset string) []byte {
+	encoded, err := EncodeCharset([]byte(text), charset)
+	if err != nil {
+		t.Fatal("cannot encode test text to", charset, err)
+	}
+	return encoded
+}
+
+func TestDetectCharset(t *testing.T) {
+	testData := []struct {
+		text, charset string
+	}{
+		{detectRussian, "windows-1251"},
+		{detectRussian, "koi8-r"},
+		{detectChinese, "gbk"},
+		{detectJapanese, "shift_jis"},
+		{detectJapanese, "euc-jp"},
+		{detectKorean, "euc-kr"},
+		{detectLatin, "windows-1252"},
+		{detectJapanese, "iso-2022-jp"},
+		{detectRussian, "utf-8"},
+		{"plain old text", "us-ascii"},
+	}
+
+	for _, val := range testData {
+		charset, confidence := DetectCharset(encodeTestText(t, val.text, val.charset))
+		if charset != val.charset {
+			t.Errorf("expected %v but have %v (confidence %v)", val.charset, charset, confidence)
+		} else if confidence < minDetectConfidence {
+			t.Errorf("too low confidence %v for %v", confidence, val.charset)
+		}
+	}
+
+	boms := map[string][]byte{
+		"utf-8":    []byte("\xef\xbb\xbftext"),
+		"utf-16be": []byte("\xfe\xff\x00t\x00e\x00x\x00t"),
+		"utf-16le": []byte("\xff\xfet\x00e\x00x\x00t\x00"),
+	}
+	for expected, data := range boms {
+		if charset, confidence := DetectCharset(data); charset != expected || confidence != 1 {
+			t.Errorf("expected %v but have %v (confidence %v)", expected, charset, confidence)
+		}
+	}
+}
+
+func TestDecodeCharsetDetection(t *testing.T) {
+	encoded := encodeTestText(t, detectRussian, "koi8-r")
+
+	decoded, err := DecodeCharset(encoded, "text/plain", map[string]string{})
+	if err != nil {
+		t.Fatal("expected detection but have", err)
+	}
+	if string(decoded) != detectRussian {
+		t.Errorf("unexpected decoded text %q", decoded)
+	}
+
+	// binary content is never guessed
+	decoded, err = DecodeCharset(encoded, "application/octet-stream", map[string]string{})
+	if err != nil || !bytes.Equal(decoded, encoded) {
+		t.Error("binary content was changed", err)
+	}
+
+	// random bytes do not look like any language
+	if _, err = DecodeCharset([]byte("\x81\x8d\x8f\x90\x9d"), "text/plain", map[string]string{}); err == nil {
+		t.Error("expected error for undetectable content")
+	}
+}
+
+func TestCharsetMismatchWarning(t *testing.T) {
+	message := "Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		string(encodeTestText(t, detectRussian, "windows-1251")) + "\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"\r\n" +
+		string(encodeTestText(t, detectRussian, "koi8-r")) + "\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=us-ascii\r\n" +
+		"\r\n" +
+		detectChinese + "\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"\r\n" +
+		string(encodeTestText(t, detectLatin, "iso-8859-1")) + "\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=gb2312\r\n" +
+		"\r\n" +
+		string(encodeTestText(t, detectChinese, "gbk")) + "\r\n" +
+		"--b--\r\n"
+
+	mm, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagnostics := NewDiagnostics()
+	plainTextCollector := NewPlainTextCollector(NewMIMEPrinter())
+	plainTextCollector.SetDiagnostics(diagnostics)
+	visitor := NewMimeVisitor(plainTextCollector)
+	visitor.SetDiagnostics(diagnostics)
+	if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+		t.Fatal("visit error", err)
+	}
+
+	var warnings []string
+	for _, w := range diagnostics.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	expected := []string{
+		"part 1: missing charset: detected windows-1251",
+		"part 2: charset mismatch: declared iso-8859-1, detected koi8-r",
+		"part 3: charset mismatch: declared us-ascii, detected utf-8",
+	}
+	if strings.Join(warnings, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+	if plain := plainTextCollector.GetPlainText(); !strings.HasPrefix(plain, detectRussian) {
+		t.Errorf("detected part was not decoded %q", plain)
+	}
+}
@@ -0,0 +1,180 @@
+package gomime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/transform"
+)
+
+// EncodePolicy tells encoder what to do with characters which can not be
+// represented in the target charset
+type EncodePolicy int
+
+const (
+	// EncodeStrict fails with UnrepresentableError
+	EncodeStrict EncodePolicy = iota
+	// EncodeReplace replaces each character with '?'
+	EncodeReplace
+	// EncodeFallbackUTF8 keeps whole content in UTF-8. The caller must
+	// label the content with charset reported in EncodeResult.
+	EncodeFallbackUTF8
+)
+
+// UnrepresentableError is returned for character which can not be encoded
+// in the target charset
+type UnrepresentableError struct {
+	Charset string
+	Rune    rune
+}
+
+func (e *UnrepresentableError) Error() string {
+	return fmt.Sprintf("gomime: character %q can not be encoded in %v", e.Rune, e.Charset)
+}
+
+// EncodeResult is content encoded by EncodeCharsetWithPolicy
+type EncodeResult struct {
+	Data []byte
+	// Charset of Data, it is "utf-8" when policy EncodeFallbackUTF8 was
+	// applied
+	Charset string
+	// Unrepresentable is number of characters which were replaced or which
+	// caused fallback to UTF-8
+	Unrepresentable int
+}
+
+// EncodeCharset encodes UTF-8 content to charset. It uses the same charset
+// aliases as DecodeCharset and fails with UnrepresentableError for
+// characters which can not be represented in the charset.
+func EncodeCharset(original []byte, charset string) ([]byte, error) {
+	result, err := EncodeCharsetWithPolicy(original, charset, EncodeStrict)
+	if err != nil {
+		return nil, err
+	}
+	return result.Data, nil
+}
+
+// EncodeCharsetWithPolicy encodes UTF-8 content to charset. Characters
+// which can not be represented are handled by policy.
+func EncodeCharsetWithPolicy(original []byte, charset string, policy EncodePolicy) (result *EncodeResult, err error) {
+	encoder, err := selectEncoder(charset)
+	if err != nil {
+		return nil, err
+	}
+	pt := &policyTransformer{encoder: encoder, charset: charset, policy: policy}
+	if policy == EncodeFallbackUTF8 {
+		pt.policy = EncodeReplace
+	}
+
+	data, _, err := transform.Bytes(pt, original)
+	if err != nil {
+		return nil, err
+	}
+	result = &EncodeResult{Data: data, Charset: charset, Unrepresentable: pt.unrepresentable}
+	if policy == EncodeFallbackUTF8 && pt.unrepresentable > 0 {
+		result.Data, result.Charset = original, "utf-8"
+	}
+	return result, nil
+}
+
+// NewCharsetWriter returns writer which encodes UTF-8 content to charset
+// and writes it to w. Close must be called to flush the end of content.
+// Policy EncodeFallbackUTF8 is not supported because the charset can not
+// change after part of content was written.
+func NewCharsetWriter(w io.Writer, charset string, policy EncodePolicy) (io.WriteCloser, error) {
+	if policy == EncodeFallbackUTF8 {
+		return nil, errors.New("gomime: fallback to utf-8 is not supported by streaming encoder")
+	}
+	encoder, err := selectEncoder(charset)
+	if err != nil {
+		return nil, err
+	}
+	return transform.NewWriter(w, &policyTransformer{encoder: encoder, charset: charset, policy: policy}), nil
+}
+
+// selectEncoder returns encoder of charset. Unlike decoding, US-ASCII and
+// ISO-8859-1 are not extended to Windows-1252 unless they were registered.
+func selectEncoder(charset string) (encoder transform.Transformer, err error) {
+	if enc := DefaultCharsetRegistry.registered(charset); enc != nil {
+		return enc.NewEncoder(), nil
+	}
+	switch normalizeCharset(charset) {
+	case "ascii", "us-ascii":
+		return asciiEncoder{}, nil
+	case "iso-8859-1":
+		return charmap.ISO8859_1.NewEncoder(), nil
+	}
+	var enc encoding.Encoding
+	if enc, err = getEncoding(charset); err != nil {
+		return
+	}
+	return enc.NewEncoder(), nil
+}
+
+// asciiEncoder fails on any non-ASCII byte
+type asciiEncoder struct {
+	transform.NopResetter
+}
+
+var errNotASCII = errors.New("gomime: non-ascii character")
+
+func (asciiEncoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc, nDst = nSrc+1, nDst+1 {
+		if src[nSrc] >= utf8.RuneSelf {
+			return nDst, nSrc, errNotASCII
+		}
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		dst[nDst] = src[nSrc]
+	}
+	return
+}
+
+// replacementChar is written instead of unrepresentable characters
+var replacementChar = []byte("?")
+
+// policyTransformer applies EncodePolicy on errors of encoder
+type policyTransformer struct {
+	encoder         transform.Transformer
+	charset         string
+	policy          EncodePolicy
+	unrepresentable int
+}
+
+func (pt *policyTransformer) Reset() {
+	pt.encoder.Reset()
+	pt.unrepresentable = 0
+}
+
+func (pt *policyTransformer) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for {
+		var n, m int
+		n, m, err = pt.encoder.Transform(dst[nDst:], src[nSrc:], atEOF)
+		nDst, nSrc = nDst+n, nSrc+m
+		if err == nil || err == transform.ErrShortDst || err == transform.ErrShortSrc {
+			return
+		}
+
+		// the encoder stops at unrepresentable or invalid character
+		if !utf8.FullRune(src[nSrc:]) && !atEOF {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+		if pt.policy != EncodeReplace {
+			return nDst, nSrc, &UnrepresentableError{Charset: pt.charset, Rune: r}
+		}
+		if len(dst)-nDst < utf8.UTFMax*2 {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		if n, _, err = pt.encoder.Transform(dst[nDst:], replacementChar, false); err != nil {
+			return
+		}
+		nDst, nSrc = nDst+n, nSrc+size
+		pt.unrepresentable++
+	}
+}
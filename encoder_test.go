@@ -0,0 +1,100 @@
+package gomime
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeCharset(t *testing.T) {
+	testData := []struct {
+		charset  string
+		message  string
+		expected []byte
+	}{
+		{"koi8-r", "азбукаабвгдеё", []byte{0xC1, 0xDA, 0xC2, 0xD5, 0xCB, 0xC1, 0xC1, 0xC2, 0xD7, 0xC7, 0xC4, 0xC5, 0xA3}},
+		{"csKOI8R", "азбука", []byte{0xC1, 0xDA, 0xC2, 0xD5, 0xCB, 0xC1}},
+		{"cp1250", "áäčéěô", []byte{225, 228, 232, 233, 236, 244}},
+		{"latin2", "čš", []byte{0xE8, 0xB9}},
+		{"ISO-8859-1", "ÄËÖÜäëöü", []byte{196, 203, 214, 220, 228, 235, 246, 252}},
+		{"iso-2022-jp", "返却", []byte("\x1b$BJV5Q\x1b(B")},
+		{"us-ascii", "plain text", []byte("plain text")},
+		{"utf-8", "žluťoučký", []byte("žluťoučký")},
+	}
+
+	for _, val := range testData {
+		encoded, err := EncodeCharset([]byte(val.message), val.charset)
+		if err != nil || !bytes.Equal(encoded, val.expected) {
+			t.Errorf("unexpected encoding of %q to %v: %v %v", val.message, val.charset, encoded, err)
+			continue
+		}
+		decoded, err := DecodeCharset(encoded, "text/plain", map[string]string{"charset": val.charset})
+		if err != nil || string(decoded) != val.message {
+			t.Errorf("unexpected round trip of %q in %v: %q %v", val.message, val.charset, decoded, err)
+		}
+	}
+
+	if _, err := EncodeCharset([]byte("x"), "csWrong"); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+}
+
+func TestEncodeCharsetPolicy(t *testing.T) {
+	original := []byte("naïve € ž")
+
+	_, err := EncodeCharset(original, "iso-8859-1")
+	if unrepresentable, ok := err.(*UnrepresentableError); !ok || unrepresentable.Rune != '€' {
+		t.Error("expected UnrepresentableError for € but have", err)
+	}
+	if _, err = EncodeCharset([]byte("é"), "us-ascii"); err == nil {
+		t.Error("expected error for non-ascii character")
+	}
+
+	result, err := EncodeCharsetWithPolicy(original, "iso-8859-1", EncodeReplace)
+	if err != nil || !bytes.Equal(result.Data, []byte("na\xefve ? ?")) || result.Unrepresentable != 2 || result.Charset != "iso-8859-1" {
+		t.Errorf("unexpected replaced result %+v %v", result, err)
+	}
+	result, err = EncodeCharsetWithPolicy(original, "iso-2022-jp", EncodeReplace)
+	if err != nil || string(result.Data) != "na?ve ? ?" {
+		t.Errorf("unexpected replaced result %+v %v", result, err)
+	}
+
+	result, err = EncodeCharsetWithPolicy(original, "iso-8859-1", EncodeFallbackUTF8)
+	if err != nil || !bytes.Equal(result.Data, original) || result.Charset != "utf-8" || result.Unrepresentable != 2 {
+		t.Errorf("unexpected fallback result %+v %v", result, err)
+	}
+	result, err = EncodeCharsetWithPolicy([]byte("naïve"), "iso-8859-1", EncodeFallbackUTF8)
+	if err != nil || string(result.Data) != "na\xefve" || result.Charset != "iso-8859-1" {
+		t.Errorf("unexpected result without fallback %+v %v", result, err)
+	}
+}
+
+func TestCharsetWriter(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := NewCharsetWriter(buf, "koi8-r", EncodeReplace)
+	if err != nil {
+		t.Fatal("writer error", err)
+	}
+	// split in the middle of multibyte character
+	message := []byte("азбука € ё")
+	for _, chunk := range [][]byte{message[:3], message[3:12], message[12:]} {
+		if _, err = w.Write(chunk); err != nil {
+			t.Fatal("write error", err)
+		}
+	}
+	if err = w.Close(); err != nil {
+		t.Fatal("close error", err)
+	}
+	if expected := []byte{0xC1, 0xDA, 0xC2, 0xD5, 0xCB, 0xC1, ' ', '?', ' ', 0xA3}; !bytes.Equal(buf.Bytes(), expected) {
+		t.Errorf("expected %v but have %v", expected, buf.Bytes())
+	}
+
+	w, _ = NewCharsetWriter(&bytes.Buffer{}, "koi8-r", EncodeStrict)
+	if _, err = w.Write([]byte("€")); err == nil {
+		if err = w.Close(); err == nil {
+			t.Error("expected error for unrepresentable character")
+		}
+	}
+	if _, err = NewCharsetWriter(buf, "koi8-r", EncodeFallbackUTF8); err == nil {
+		t.Error("expected error for fallback policy")
+	}
+}
@@ -1,18 +1,15 @@
 package gomime
 
 import (
+	"bufio"
 	"fmt"
 	"io"
 	"mime"
-	"mime/quotedprintable"
 	"regexp"
 	"strings"
 	"unicode/utf8"
 
-	"encoding/base64"
-
 	"golang.org/x/text/encoding"
-	"golang.org/x/text/encoding/htmlindex"
 )
 
 var wordDec = &mime.WordDecoder{
@@ -28,13 +25,59 @@ var wordDec = &mime.WordDecoder{
 	},
 }
 
-// expected trimmed low case
+// getEncoding returns encoding of charset from DefaultCharsetRegistry
 func getEncoding(charset string) (enc encoding.Encoding, err error) {
-	preparsed := strings.Trim(strings.ToLower(charset), " \t\r\n")
+	return DefaultCharsetRegistry.Lookup(charset)
+}
+
+// Patterns of charset families. They are matched only when the name
+// contains their keyword, so common names like utf-8 skip all of them.
+var (
+	koiCharsetRegexp     = regexp.MustCompile("(cs)?koi[-_ ]?8?[-_ ]?(r|ru|u|uk)?$")
+	windowsCharsetRegexp = regexp.MustCompile("(cp|(cs)?win(dows)?)[-_ ]?([0-9]{3,4})$")
+	isoCharsetRegexp     = regexp.MustCompile("iso[-_ ]?([0-9]{4})[-_ ]?([0-9]+|jp)?[-_ ]?(i|e)?")
+)
+
+// latinCharsets maps latin-N labels (e.g. l2, latin-2, csisolatin2) to
+// iso-8859 charsets
+var latinCharsets = func() map[string]string {
+	charsets := map[string]string{}
+	for number, charset := range map[string]string{
+		"1":  "iso-8859-1",
+		"2":  "iso-8859-2",
+		"3":  "iso-8859-3",
+		"4":  "iso-8859-4",
+		"5":  "iso-8859-5",
+		"6":  "iso-8859-10",
+		"8":  "iso-8859-14",
+		"9":  "iso-8859-15",
+		"10": "iso-8859-16",
+	} {
+		for _, prefix := range []string{"", "cs", "csiso"} {
+			for _, latin := range []string{"l", "latin"} {
+				for _, separator := range []string{"", "-", "_", " "} {
+					charsets[prefix+latin+separator+number] = charset
+				}
+			}
+		}
+	}
+	return charsets
+}()
+
+// findCharsetFamily returns submatches of pattern when name contains keyword
+func findCharsetFamily(name, keyword string, pattern *regexp.Regexp) [][]string {
+	if !strings.Contains(name, keyword) {
+		return nil
+	}
+	return pattern.FindAllStringSubmatch(name, -1)
+}
+
+// normalizeCharset maps charset aliases to names known to htmlindex
+func normalizeCharset(charset string) string {
+	preparsed := charsetKey(charset)
 
 	// koi
-	re := regexp.MustCompile("(cs)?koi[-_ ]?8?[-_ ]?(r|ru|u|uk)?$")
-	matches := re.FindAllStringSubmatch(preparsed, -1)
+	matches := findCharsetFamily(preparsed, "koi", koiCharsetRegexp)
 	if len(matches) == 1 && len(matches[0]) == 3 {
 		preparsed = "koi8-"
 		switch matches[0][2] {
@@ -46,8 +89,10 @@ func getEncoding(charset string) (enc encoding.Encoding, err error) {
 	}
 
 	// windows-XXXX
-	re = regexp.MustCompile("(cp|(cs)?win(dows)?)[-_ ]?([0-9]{3,4})$")
-	matches = re.FindAllStringSubmatch(preparsed, -1)
+	matches = findCharsetFamily(preparsed, "cp", windowsCharsetRegexp)
+	if matches == nil {
+		matches = findCharsetFamily(preparsed, "win", windowsCharsetRegexp)
+	}
 	if len(matches) == 1 && len(matches[0]) == 5 {
 		switch matches[0][4] {
 		case "874", "1250", "1251", "1252", "1253", "1254", "1255", "1256", "1257", "1258":
@@ -56,8 +101,7 @@ func getEncoding(charset string) (enc encoding.Encoding, err error) {
 	}
 
 	// iso
-	re = regexp.MustCompile("iso[-_ ]?([0-9]{4})[-_ ]?([0-9]+|jp)?[-_ ]?(i|e)?")
-	matches = re.FindAllStringSubmatch(preparsed, -1)
+	matches = findCharsetFamily(preparsed, "iso", isoCharsetRegexp)
 	if len(matches) == 1 && len(matches[0]) == 4 {
 		if matches[0][1] == "2022" && matches[0][2] == "jp" {
 			preparsed = "iso-2022-jp"
@@ -76,23 +120,8 @@ func getEncoding(charset string) (enc encoding.Encoding, err error) {
 	}
 
 	// latin is tricky
-	re = regexp.MustCompile("^(cs|csiso)?l(atin)?[-_ ]?([0-9]{1,2})$")
-	matches = re.FindAllStringSubmatch(preparsed, -1)
-	if len(matches) == 1 && len(matches[0]) == 4 {
-		switch matches[0][3] {
-		case "1":
-			preparsed = "windows-1252"
-		case "2", "3", "4", "5":
-			preparsed = "iso-8859-" + matches[0][3]
-		case "6":
-			preparsed = "iso-8859-10"
-		case "8":
-			preparsed = "iso-8859-14"
-		case "9":
-			preparsed = "iso-8859-15"
-		case "10":
-			preparsed = "iso-8859-16"
-		}
+	if charset, ok := latinCharsets[preparsed]; ok {
+		preparsed = charset
 	}
 
 	// missing substitutions
@@ -136,29 +165,22 @@ func getEncoding(charset string) (enc encoding.Encoding, err error) {
 	case "macroman":
 		preparsed = "macintosh"
 	}
-
-	enc, _ = htmlindex.Get(preparsed)
-	if enc == nil {
-		err = fmt.Errorf("can not get encodig for '%s' (or '%s')", charset, preparsed)
-	}
-	return
+	return preparsed
 }
 
 func selectDecoder(charset string) (decoder *encoding.Decoder, err error) {
 	var enc encoding.Encoding
-	lcharset := strings.Trim(strings.ToLower(charset), " \t\r\n")
-	switch lcharset {
-	case "utf7", "utf-7", "unicode-1-1-utf-7":
-		return NewUtf7Decoder(), nil
-	default:
-		enc, err = getEncoding(lcharset)
-	}
-	if err == nil {
+	if enc, err = getEncoding(charset); err == nil {
 		decoder = enc.NewDecoder()
 	}
 	return
 }
 
+func isKnownCharset(charset string) bool {
+	_, err := selectDecoder(charset)
+	return err == nil
+}
+
 // DecodeHeader if needed. Returns error if raw contains non-utf8 characters
 func DecodeHeader(raw string) (decoded string, err error) {
 	if decoded, err = wordDec.DecodeHeader(raw); err != nil {
@@ -170,42 +192,112 @@ func DecodeHeader(raw string) (decoded string, err error) {
 	return
 }
 
-// EncodeHeader using quoted printable and utf8
-func EncodeHeader(s string) string {
-	return mime.QEncoding.Encode("utf-8", s)
-}
-
 // DecodeCharset decodes the orginal using content type parameters. When
-// charset missing it checks the content is utf8-valid.
+// charset missing it checks the content is utf8-valid. Non-utf8 text without
+// charset is decoded by charset guessed by DetectCharset when detection is
+// confident enough.
 func DecodeCharset(original []byte, mediaType string, contentTypeParams map[string]string) ([]byte, error) {
+	decoded, _, err := decodeCharset(original, mediaType, contentTypeParams)
+	return decoded, err
+}
+
+// decodeCharset is DecodeCharset which also returns detected charset
+func decodeCharset(original []byte, mediaType string, contentTypeParams map[string]string) (decoded []byte, detected string, err error) {
 	var decoder *encoding.Decoder
-	var err error
 	if charset, ok := contentTypeParams["charset"]; ok {
 		decoder, err = selectDecoder(charset)
 	} else {
-		if !strings.HasPrefix(mediaType, "text/") || utf8.Valid(original) {
-			return original, nil
+		if !strings.HasPrefix(mediaType, "text/") || isPlainUTF8(original) {
+			return original, "", nil
+		}
+		var confidence float64
+		if detected, confidence = DetectCharset(original); confidence >= minDetectConfidence {
+			decoder, err = selectDecoder(detected)
+		} else {
+			detected = ""
+			err = fmt.Errorf("non-utf8 content without charset specification")
 		}
-		err = fmt.Errorf("non-utf8 content without charset specification")
 	}
 	if err != nil {
-		return original, err
+		return original, "", err
 	}
 	utf8, err := decoder.Bytes(original)
 	if err != nil {
-		return original, err
+		return original, "", err
+	}
+
+	return utf8, detected, nil
+}
+
+// DecodeCharsetReader returns reader which decodes r to UTF-8 using content
+// type parameters like DecodeCharset. Without charset only the beginning of
+// content is checked for UTF-8 validity and used for detection of charset.
+// The original content is read from the returned reader when it fails.
+func DecodeCharsetReader(r io.Reader, mediaType string, contentTypeParams map[string]string) (io.Reader, error) {
+	decoded, _, _, err := decodeCharsetReader(r, mediaType, contentTypeParams)
+	return decoded, err
+}
+
+// decodeCharsetReader is DecodeCharsetReader which also returns the
+// beginning of text content and detected charset
+func decodeCharsetReader(r io.Reader, mediaType string, contentTypeParams map[string]string) (decoded io.Reader, sample []byte, detected string, err error) {
+	if strings.HasPrefix(mediaType, "text/") {
+		buffered := bufio.NewReaderSize(r, detectSampleSize)
+		sample, _ = buffered.Peek(detectSampleSize)
+		sample = trimIncompleteRune(sample)
+		r = buffered
 	}
 
-	return utf8, nil
+	var decoder *encoding.Decoder
+	if charset, ok := contentTypeParams["charset"]; ok {
+		decoder, err = selectDecoder(charset)
+	} else {
+		if !strings.HasPrefix(mediaType, "text/") || isPlainUTF8(sample) {
+			return r, sample, "", nil
+		}
+		var confidence float64
+		if detected, confidence = DetectCharset(sample); confidence >= minDetectConfidence {
+			decoder, err = selectDecoder(detected)
+		} else {
+			detected = ""
+			err = fmt.Errorf("non-utf8 content without charset specification")
+		}
+	}
+	if err != nil {
+		return r, sample, "", err
+	}
+	return decoder.Reader(r), sample, detected, nil
+}
+
+// trimIncompleteRune removes incomplete UTF-8 sequence from the end of data
+func trimIncompleteRune(data []byte) []byte {
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				return data[:i]
+			}
+			break
+		}
+	}
+	return data
 }
 
-// DecodeContentEncoding wraps the reader with decoder based on content encoding
+// DecodeContentEncoding wraps the reader with decoder based on content
+// encoding normalized by NormalizeTransferEncoding. Nil is returned for
+// unsupported encoding. Base64 and quoted-printable are decoded by
+// LenientDecoder.
 func DecodeContentEncoding(r io.Reader, contentEncoding string) (d io.Reader) {
-	switch strings.ToLower(contentEncoding) {
+	switch NormalizeTransferEncoding(contentEncoding) {
 	case "quoted-printable":
-		d = quotedprintable.NewReader(r)
+		d = NewLenientQuotedPrintableDecoder(r)
 	case "base64":
-		d = base64.NewDecoder(base64.StdEncoding, r)
+		d = NewLenientBase64Decoder(r)
+	case "x-uuencode":
+		d = newUUDecoder(r)
+	case "x-yenc":
+		d = newYEncDecoder(r)
+	case "x-binhex":
+		d = newBinHexDecoder(r)
 	case "7bit", "8bit", "binary", "": // Nothing to do
 		d = r
 	}
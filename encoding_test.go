@@ -3,6 +3,7 @@ package gomime
 import (
 	"bytes"
 	//"fmt"
+	"io/ioutil"
 	"strings"
 	"testing"
 
@@ -57,6 +58,45 @@ func TestDecodeCharsetBoundaryInputs(t *testing.T) {
 	}
 }
 
+func TestDecodeCharsetReader(t *testing.T) {
+	testData := []struct {
+		encoded, mediaType string
+		params             map[string]string
+		expected           string
+	}{
+		{string(encodeTestText(t, detectRussian, "koi8-r")), "text/plain", map[string]string{"charset": "koi8-r"}, detectRussian},
+		{"Hi Mom -+Jjo--!", "text/plain", map[string]string{"charset": "utf-7"}, "Hi Mom -☺-!"},
+		// detected without charset
+		{string(encodeTestText(t, detectRussian, "koi8-r")), "text/plain", map[string]string{}, detectRussian},
+		{detectLatin, "text/html", map[string]string{}, detectLatin},
+		// binary content is not touched
+		{"\x81\x8d\x8f", "application/octet-stream", map[string]string{}, "\x81\x8d\x8f"},
+	}
+	for _, val := range testData {
+		r, err := DecodeCharsetReader(strings.NewReader(val.encoded), val.mediaType, val.params)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", val.encoded, err)
+			continue
+		}
+		decoded, err := ioutil.ReadAll(r)
+		if err != nil || string(decoded) != val.expected {
+			t.Errorf("%q: expected %q but have %q, %v", val.encoded, val.expected, decoded, err)
+		}
+	}
+
+	// the original content is readable after error
+	r, err := DecodeCharsetReader(strings.NewReader("\x81\x8d\x8f\x90\x9d"), "text/plain", map[string]string{})
+	if err == nil {
+		t.Error("expected error for undetectable content")
+	}
+	if original, _ := ioutil.ReadAll(r); string(original) != "\x81\x8d\x8f\x90\x9d" {
+		t.Errorf("unexpected original content %q", original)
+	}
+	if _, err = DecodeCharsetReader(strings.NewReader("text"), "text/plain", map[string]string{"charset": "x-unknown"}); err == nil {
+		t.Error("expected error for unknown charset")
+	}
+}
+
 func TestGetEncoding(t *testing.T) {
 	// all MIME charset with aliases can be found here https://www.iana.org/assignments/character-sets/character-sets.xhtml
 	mimesets := map[string][]string{
@@ -0,0 +1,120 @@
+package gomime
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/textproto"
+	"sort"
+	"strings"
+)
+
+// ErrAllPartsRemoved is returned when the last part of multipart would be
+// removed, by Part.Remove or by filter for the top-level multipart
+var ErrAllPartsRemoved = errors.New("gomime: all parts of multipart removed")
+
+// PartFilter decides about part with header h. It returns keep for part
+// which stays in the message, otherwise the part is replaced by replacement
+// or removed when replacement is nil. Each call must return new replacement.
+type PartFilter func(h textproto.MIMEHeader) (keep bool, replacement *Part)
+
+// FilterParts reads message from r and writes it to w without parts
+// rejected by filter. Parts which were kept are written byte-exact, see
+// Part.WriteTo. The message is parsed to Part tree instead of being visited
+// by MimeVisitor, because only the tree keeps raw parts and delimiters
+// needed for byte-exact output.
+func FilterParts(w io.Writer, r io.Reader, filter PartFilter) error {
+	root, err := Parse(r)
+	if err != nil {
+		return err
+	}
+	if err = root.FilterParts(filter); err != nil {
+		return err
+	}
+	_, err = root.WriteTo(w)
+	return err
+}
+
+// FilterParts removes or replaces descendants of the part rejected by
+// filter. Children of kept parts and parts of embedded messages are
+// filtered too, the top-level part of embedded message is not passed to
+// filter. Multipart left without children is removed as well, together
+// with the embedded message part when it is the top-level part of embedded
+// message. The part is not changed when ErrAllPartsRemoved is returned.
+func (p *Part) FilterParts(filter PartFilter) error {
+	edits, empty := p.filterEdits(filter)
+	if !empty {
+		for _, edit := range edits {
+			if err := edit(); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	removed := p
+	if removed.Parent != nil && isEmbeddedMessage(removed.Parent.MediaType) {
+		removed = removed.Parent
+	}
+	if removed.Parent != nil && strings.HasPrefix(removed.Parent.MediaType, "multipart/") {
+		return removed.Remove()
+	}
+	return ErrAllPartsRemoved
+}
+
+// filterEdits calls filter for descendants of the part and returns edits
+// which apply its decisions. Empty is true for multipart (or embedded
+// message with such multipart) which would be left without children, its
+// descendants need not be edited then.
+func (p *Part) filterEdits(filter PartFilter) (edits []func() error, empty bool) {
+	if isEmbeddedMessage(p.MediaType) && len(p.Children) == 1 {
+		return p.Children[0].filterEdits(filter)
+	}
+	if len(p.Children) == 0 {
+		return nil, false
+	}
+
+	removed := 0
+	for _, child := range p.Children {
+		child := child
+		keep, replacement := filter(child.Header)
+		switch {
+		case keep:
+			childEdits, childEmpty := child.filterEdits(filter)
+			if !childEmpty {
+				edits = append(edits, childEdits...)
+				continue
+			}
+			fallthrough
+		case replacement == nil:
+			edits = append(edits, child.Remove)
+			removed++
+		default:
+			edits = append(edits, func() error { return child.Replace(replacement) })
+		}
+	}
+	return edits, removed == len(p.Children)
+}
+
+// NewPart returns non-multipart part with header fields sorted by key and
+// raw body which must be already encoded by Content-Transfer-Encoding of
+// header. It can be used as replacement of parsed part.
+func NewPart(header textproto.MIMEHeader, body []byte) *Part {
+	keys := make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	for _, key := range keys {
+		for _, value := range header[key] {
+			writeHeaderField(buf, key, encodeHeaderValue(key, value))
+		}
+	}
+	buf.WriteString("\r\n")
+
+	p := &Part{Header: header, rawHeader: buf.Bytes(), rawBody: body, modified: true}
+	_ = p.parseContentHeaders()
+	return p
+}
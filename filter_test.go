@@ -0,0 +1,142 @@
+package gomime
+
+import (
+	"bytes"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func isAttachmentHeader(h textproto.MIMEHeader) bool {
+	disposition, _, _ := ParseMediaType(h.Get("Content-Disposition"))
+	return disposition == "attachment"
+}
+
+func TestFilterPartsReplace(t *testing.T) {
+	placeholder := "Content-Type: text/plain; charset=utf-8\r\n\r\nAttachment removed"
+	buf := &bytes.Buffer{}
+	err := FilterParts(buf, strings.NewReader(partTestMessage), func(h textproto.MIMEHeader) (bool, *Part) {
+		if !isAttachmentHeader(h) {
+			return true, nil
+		}
+		return false, NewPart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}}, []byte("Attachment removed"))
+	})
+	if err != nil {
+		t.Fatal("filter error", err)
+	}
+
+	expected := strings.Replace(partTestMessage, "Content-Type: application/octet-stream\r\n"+
+		"Content-Transfer-Encoding: base64\r\n"+
+		"Content-Disposition: attachment; filename=\"data.bin\"\r\n"+
+		"\r\n"+
+		"AAECAwQF", placeholder, 1)
+	if buf.String() != expected {
+		t.Errorf("expected\n%q\nbut have\n%q", expected, buf.String())
+	}
+}
+
+func TestFilterPartsRemove(t *testing.T) {
+	root, err := Parse(strings.NewReader(forwardedTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	var seen []string
+	err = root.FilterParts(func(h textproto.MIMEHeader) (bool, *Part) {
+		mediaType, _, _ := getContentType(h)
+		seen = append(seen, mediaType)
+		return mediaType != "message/global", nil
+	})
+	if err != nil {
+		t.Fatal("filter error", err)
+	}
+	if strings.Join(seen, ",") != "text/plain,message/rfc822,text/plain,message/global" {
+		t.Errorf("unexpected filtered parts %v", seen)
+	}
+
+	written := writePart(t, root)
+	if strings.Contains(written, "Carol") || !strings.Contains(written, "the report\r\n--fwd--\r\n") {
+		t.Errorf("unexpected filtered message %q", written)
+	}
+	if _, err = Parse(strings.NewReader(written)); err != nil {
+		t.Error("parse error of filtered message", err)
+	}
+}
+
+func TestFilterPartsRemoveEmptyMultipart(t *testing.T) {
+	root, err := Parse(strings.NewReader(partTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	err = root.FilterParts(func(h textproto.MIMEHeader) (bool, *Part) {
+		return !strings.HasPrefix(h.Get("Content-Type"), "text/"), nil
+	})
+	if err != nil {
+		t.Fatal("filter error", err)
+	}
+	if len(root.Children) != 1 || root.Children[0].MediaType != "application/octet-stream" {
+		t.Errorf("expected only attachment but have %d parts", len(root.Children))
+	}
+
+	err = root.FilterParts(func(h textproto.MIMEHeader) (bool, *Part) {
+		return false, nil
+	})
+	if err != ErrAllPartsRemoved {
+		t.Error("expected ErrAllPartsRemoved but have", err)
+	}
+}
+
+func TestFilterPartsEmptyEmbeddedMessage(t *testing.T) {
+	message := "Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"\r\n" +
+		"pdf\r\n" +
+		"--outer\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"Subject: forwarded\r\n" +
+		"Content-Type: multipart/mixed; boundary=inner\r\n" +
+		"\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"text\r\n" +
+		"--inner--\r\n" +
+		"--outer--\r\n"
+	isText := func(h textproto.MIMEHeader) (bool, *Part) {
+		return !strings.HasPrefix(h.Get("Content-Type"), "text/"), nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := FilterParts(buf, strings.NewReader(message), isText); err != nil {
+		t.Fatal("filter error", err)
+	}
+	expected := "Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf\r\n" +
+		"\r\n" +
+		"pdf\r\n" +
+		"--outer--\r\n"
+	if buf.String() != expected {
+		t.Errorf("expected\n%q\nbut have\n%q", expected, buf.String())
+	}
+
+	// nothing is changed when all parts would be removed
+	root, err := Parse(strings.NewReader(forwardedTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	err = root.FilterParts(func(h textproto.MIMEHeader) (bool, *Part) {
+		return h.Get("Content-Type") == "message/rfc822", nil
+	})
+	if err != ErrAllPartsRemoved {
+		t.Fatal("expected ErrAllPartsRemoved but have", err)
+	}
+	buf.Reset()
+	if _, err = root.WriteTo(buf); err != nil || buf.String() != forwardedTestMessage {
+		t.Errorf("message was changed %q, %v", buf.String(), err)
+	}
+}
@@ -0,0 +1,447 @@
+package gomime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// encodedWordRegexp matches RFC 2047 encoded-word. Unlike mime.WordDecoder
+// it is also used inside quoted strings and for words which are not
+// separated by whitespace.
+var encodedWordRegexp = regexp.MustCompile(`=\?([^?\s]+)\?([bBqQ])\?([^?\s]*)\?=`)
+
+// headerSegment is either decoded encoded-word or raw text between words
+type headerSegment struct {
+	charset string // empty for raw text
+	data    []byte
+	raw     string // encoded-words of the segment
+	space   string // dropped whitespace before encoded-word
+}
+
+// DecodeHeaderWithFallback decodes header like DecodeHeader but it does not
+// fail on raw 8-bit text which is not wrapped in encoded-words. Such text is
+// decoded by the first of charsets (e.g. charset of message body or default
+// charset) which decodes it without errors, otherwise by charset guessed by
+// DetectCharset. Adjacent encoded-words in the same charset are decoded
+// together so that a character split between them is not broken. Raw value
+// is returned with error when raw text can not be decoded.
+func DecodeHeaderWithFallback(raw string, charsets ...string) (decoded string, err error) {
+	segments := splitEncodedWords(raw)
+
+	var rawText [][]byte
+	for _, segment := range segments {
+		if segment.charset == "" && !utf8.Valid(segment.data) {
+			rawText = append(rawText, segment.data)
+		}
+	}
+	var fallback string
+	if len(rawText) > 0 {
+		if fallback = selectFallbackCharset(rawText, charsets); fallback == "" {
+			return raw, fmt.Errorf("header contains non utf8 chars in unknown charset")
+		}
+	}
+
+	buf := &strings.Builder{}
+	for _, segment := range segments {
+		charset := segment.charset
+		switch {
+		case charset == "" && utf8.Valid(segment.data):
+			buf.Write(segment.data)
+			continue
+		case charset == "":
+			charset = fallback
+		}
+		text, decodeErr := decodeHeaderCharset(segment.data, charset)
+		if decodeErr != nil {
+			return raw, decodeErr
+		}
+		buf.WriteString(text)
+	}
+	return buf.String(), nil
+}
+
+// DecodeHeaderWithPolicy decodes encoded-words of header. Content which is
+// not valid in its charset and raw text which is not valid UTF-8 are handled
+// by policy. DecodeBestEffort keeps encoded-words in unknown charsets as
+// they are and counts their bytes as invalid.
+func DecodeHeaderWithPolicy(raw string, policy DecodePolicy) (decoded string, invalid int, err error) {
+	buf := &strings.Builder{}
+	keptRaw := false
+	for _, segment := range splitEncodedWords(raw) {
+		charset := segment.charset
+		if charset == "" {
+			keptRaw = false
+			if utf8.Valid(segment.data) {
+				buf.Write(segment.data)
+				continue
+			}
+			charset = "utf-8"
+		}
+		text, n, decodeErr := decodeWithPolicy(segment.data, charset, policy)
+		switch {
+		case decodeErr == nil:
+			if keptRaw {
+				buf.WriteString(segment.space)
+			}
+			keptRaw = false
+		case policy == DecodeBestEffort:
+			// kept word is not encoded-word, whitespace around it matters
+			buf.WriteString(segment.space)
+			text, n, keptRaw = []byte(segment.raw), len(segment.data), true
+		default:
+			return "", 0, decodeErr
+		}
+		buf.Write(text)
+		invalid += n
+	}
+	return buf.String(), invalid, nil
+}
+
+// splitEncodedWords splits header to raw text and decoded encoded-words.
+// Whitespace between encoded-words is dropped and adjacent words in the
+// same charset are merged. Malformed encoded-words are kept as raw text.
+func splitEncodedWords(raw string) (segments []headerSegment) {
+	addText := func(text string) {
+		if text == "" {
+			return
+		}
+		if n := len(segments); n > 0 && segments[n-1].charset == "" {
+			segments[n-1].data = append(segments[n-1].data, text...)
+			return
+		}
+		segments = append(segments, headerSegment{data: []byte(text)})
+	}
+
+	last, lastWordEnd := 0, -1
+	for _, match := range encodedWordRegexp.FindAllStringSubmatchIndex(raw, -1) {
+		charset := raw[match[2]:match[3]]
+		// RFC 2231 language suffix
+		if i := strings.IndexByte(charset, '*'); i >= 0 {
+			charset = charset[:i]
+		}
+		data, err := decodeEncodedText(raw[match[4]:match[5]], raw[match[6]:match[7]])
+		if err != nil || charset == "" {
+			continue
+		}
+
+		var segment headerSegment
+		between := raw[last:match[0]]
+		n := len(segments)
+		if lastWordEnd == last && strings.Trim(between, " \t\r\n") == "" {
+			if strings.EqualFold(segments[n-1].charset, charset) {
+				segments[n-1].data = append(segments[n-1].data, data...)
+				segments[n-1].raw += raw[last:match[1]]
+				last, lastWordEnd = match[1], match[1]
+				continue
+			}
+			segment.space = between
+		} else {
+			addText(between)
+		}
+		segment.charset, segment.data, segment.raw = charset, data, raw[match[0]:match[1]]
+		segments = append(segments, segment)
+		last, lastWordEnd = match[1], match[1]
+	}
+	addText(raw[last:])
+	return
+}
+
+// decodeEncodedText decodes text of encoded-word in B or Q encoding
+func decodeEncodedText(encoding, text string) ([]byte, error) {
+	if strings.EqualFold(encoding, "b") {
+		// tolerate missing padding
+		return base64.RawStdEncoding.DecodeString(strings.TrimRight(text, "="))
+	}
+
+	data := make([]byte, 0, len(text))
+	for i := 0; i < len(text); i++ {
+		switch c := text[i]; {
+		case c == '_':
+			data = append(data, ' ')
+		case c == '=' && i+2 < len(text) && isHex(text[i+1]) && isHex(text[i+2]):
+			data = append(data, unhex(text[i+1])<<4|unhex(text[i+2]))
+			i += 2
+		default:
+			data = append(data, c)
+		}
+	}
+	return data, nil
+}
+
+// selectFallbackCharset returns charset which decodes all raw texts
+func selectFallbackCharset(rawText [][]byte, charsets []string) string {
+	for _, charset := range charsets {
+		if charset == "" {
+			continue
+		}
+		valid := true
+		for _, text := range rawText {
+			if decoded, err := decodeHeaderCharset(text, charset); err != nil || strings.ContainsRune(decoded, utf8.RuneError) {
+				valid = false
+				break
+			}
+		}
+		if valid {
+			return charset
+		}
+	}
+
+	if charset, confidence := DetectCharset(bytes.Join(rawText, []byte(" "))); confidence >= minDetectConfidence {
+		return charset
+	}
+	return ""
+}
+
+// decodeHeaderCharset decodes text of header in charset
+func decodeHeaderCharset(data []byte, charset string) (string, error) {
+	decoder, err := selectDecoder(charset)
+	if err != nil {
+		return "", err
+	}
+	decoded, err := decoder.Bytes(data)
+	if err != nil {
+		return "", err
+	}
+	return string(decoded), nil
+}
+
+const (
+	// maxEncodedWordLength is RFC 2047 limit of encoded-word
+	maxEncodedWordLength = 75
+	// maxEncodedLineLength is RFC 2047 limit of line with encoded-word
+	maxEncodedLineLength = 76
+	encodedWordPrefix    = "=?utf-8?"
+	// encodedWordOverhead is length of "=?utf-8?Q?" and "?="
+	encodedWordOverhead = len(encodedWordPrefix) + len("Q??=")
+)
+
+// EncodeHeader encodes unstructured header value (e.g. Subject). Runs of
+// words with non-ASCII characters are written as UTF-8 encoded-words using
+// the shorter of Q and B encoding, ASCII words are kept. Encoded-words are
+// split at character boundaries to fit 75 characters and separated by space
+// so that the header can be folded. Words with line breaks and words longer
+// than header line are encoded too.
+func EncodeHeader(s string) string {
+	return encodeHeader(s, maxLineLength-len(" "))
+}
+
+// encodeHeader encodes unstructured value, ASCII words longer than
+// maxWordLength are encoded so that they can be folded
+func encodeHeader(s string, maxWordLength int) string {
+	words := strings.Split(s, " ")
+	var encoded, run []string
+	flush := func() {
+		// spaces after the run stay outside of encoded-words
+		n := len(run)
+		for n > 0 && run[n-1] == "" {
+			n--
+		}
+		if n > 0 {
+			encoded = append(encoded, encodeWords(strings.Join(run[:n], " "), false)...)
+		}
+		encoded = append(encoded, run[n:]...)
+		run = nil
+	}
+	for _, word := range words {
+		switch {
+		case needsEncoding(word) || len(word) > maxWordLength:
+			run = append(run, word)
+		case word == "" && len(run) > 0:
+			// whitespace between encoded-words is ignored by decoders
+			run = append(run, word)
+		default:
+			flush()
+			encoded = append(encoded, word)
+		}
+	}
+	flush()
+	return strings.Join(encoded, " ")
+}
+
+// EncodeAddressList formats addresses for address header (e.g. To). Only
+// non-ASCII display names are encoded, other names are quoted when needed
+// and addresses are kept as they are.
+func EncodeAddressList(addresses []*mail.Address) string {
+	formatted := make([]string, len(addresses))
+	for i, address := range addresses {
+		formatted[i] = (&mail.Address{Address: address.Address}).String()
+		switch {
+		case address.Name == "":
+		case needsEncoding(address.Name):
+			formatted[i] = strings.Join(encodeWords(address.Name, true), " ") + " " + formatted[i]
+		case strings.IndexFunc(address.Name, isNotAtomChar) >= 0:
+			formatted[i] = quoteString(address.Name) + " " + formatted[i]
+		default:
+			formatted[i] = address.Name + " " + formatted[i]
+		}
+	}
+	return strings.Join(formatted, ", ")
+}
+
+// FormatMediaTypeWithEncodedWords serializes media type like
+// FormatMediaType but non-ASCII values are written as quoted RFC 2047
+// encoded-words. It is meant for parameters like name of Content-Type which
+// are not read in RFC 2231 form by some clients.
+func FormatMediaTypeWithEncodedWords(mediaType string, params map[string]string) string {
+	ascii := map[string]string{}
+	var encoded []string
+	for key, value := range params {
+		if isASCII(value) {
+			ascii[key] = value
+			continue
+		}
+		if key == "" || strings.IndexFunc(key, isNotTokenChar) >= 0 {
+			return ""
+		}
+		encoded = append(encoded, strings.ToLower(key)+"=\""+strings.Join(encodeWords(value, false), " ")+"\"")
+	}
+	formatted := FormatMediaType(mediaType, ascii)
+	if formatted == "" || len(encoded) == 0 {
+		return formatted
+	}
+	sort.Strings(encoded)
+	return formatted + "; " + strings.Join(encoded, "; ")
+}
+
+// encodeHeaderValue encodes value of header field key which can not be
+// written as is: non-ASCII text, line breaks and words which do not fit
+// header line. Address headers and content headers with parameters keep
+// their structure.
+func encodeHeaderValue(key, value string) string {
+	maxWordLength := maxLineLength - len(key) - len(": ")
+	if isASCII(value) && !strings.ContainsAny(value, "\r\n") && !hasLongWord(value, maxWordLength) {
+		return value
+	}
+	switch textproto.CanonicalMIMEHeaderKey(key) {
+	case "From", "Sender", "Reply-To", "To", "Cc", "Bcc",
+		"Resent-From", "Resent-Sender", "Resent-To", "Resent-Cc", "Resent-Bcc":
+		if addresses, err := mail.ParseAddressList(value); err == nil {
+			if formatted := EncodeAddressList(addresses); !hasLongWord(formatted, maxWordLength) {
+				return formatted
+			}
+		}
+	case "Content-Type", "Content-Disposition":
+		if mediaType, params, err := ParseMediaType(value); err == nil {
+			if formatted := FormatMediaType(mediaType, params); formatted != "" && !hasLongWord(formatted, maxWordLength) {
+				return formatted
+			}
+		}
+	}
+	return encodeHeader(value, maxWordLength)
+}
+
+// hasLongWord returns true when value has word longer than maxWordLength,
+// header is folded only at spaces
+func hasLongWord(value string, maxWordLength int) bool {
+	for _, word := range strings.Split(value, " ") {
+		if len(word) > maxWordLength {
+			return true
+		}
+	}
+	return false
+}
+
+// needsEncoding returns true for word which can not be written as is
+func needsEncoding(word string) bool {
+	for i := 0; i < len(word); i++ {
+		if c := word[i]; c >= utf8.RuneSelf || (c < 0x20 && c != '\t') || c == 0x7f {
+			return true
+		}
+	}
+	// text which looks like encoded-word must be protected
+	return strings.Contains(word, "=?") && strings.Contains(word, "?=")
+}
+
+// isNotAtomChar returns true for characters which must be quoted in phrase
+func isNotAtomChar(r rune) bool {
+	return r != ' ' && (r <= 0x20 || r >= 0x7f || strings.ContainsRune("()<>[]:;@\\,.\"", r))
+}
+
+func quoteString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// isQChar returns true for byte which is written as is in Q encoding. In
+// phrase only the restricted set of RFC 2047 section 5 (3) is allowed.
+func isQChar(c byte, phrase bool) bool {
+	switch {
+	case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		return true
+	case phrase:
+		return strings.IndexByte("!*+-/", c) >= 0
+	}
+	return c > 0x20 && c < 0x7f && c != '=' && c != '?' && c != '_'
+}
+
+func qEncodedLen(s string, phrase bool) (n int) {
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' || isQChar(s[i], phrase) {
+			n++
+		} else {
+			n += 3
+		}
+	}
+	return
+}
+
+// encodeWords encodes text as UTF-8 encoded-words in Q or B encoding,
+// whichever is shorter. Text is split at character boundaries so that each
+// encoded-word fits 75 characters.
+func encodeWords(text string, phrase bool) (words []string) {
+	useB := base64.StdEncoding.EncodedLen(len(text)) < qEncodedLen(text, phrase)
+	encodedLen := func(s string) int {
+		if useB {
+			return base64.StdEncoding.EncodedLen(len(s))
+		}
+		return qEncodedLen(s, phrase)
+	}
+
+	const maxTextLength = maxEncodedWordLength - encodedWordOverhead
+	for len(text) > 0 {
+		end, next := 0, 0
+		for end < len(text) {
+			_, size := utf8.DecodeRuneInString(text[end:])
+			if next = end + size; encodedLen(text[:next]) > maxTextLength {
+				break
+			}
+			end = next
+		}
+		if end == 0 {
+			// a character always fits, just to be safe
+			end = next
+		}
+		words = append(words, encodeWord(text[:end], useB, phrase))
+		text = text[end:]
+	}
+	return
+}
+
+func encodeWord(s string, useB, phrase bool) string {
+	if useB {
+		return encodedWordPrefix + "B?" + base64.StdEncoding.EncodeToString([]byte(s)) + "?="
+	}
+	const hex = "0123456789ABCDEF"
+	buf := &strings.Builder{}
+	buf.WriteString(encodedWordPrefix + "Q?")
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ':
+			buf.WriteByte('_')
+		case isQChar(c, phrase):
+			buf.WriteByte(c)
+		default:
+			buf.WriteByte('=')
+			buf.WriteByte(hex[c>>4])
+			buf.WriteByte(hex[c&0xf])
+		}
+	}
+	buf.WriteString("?=")
+	return buf.String()
+}
@@ -0,0 +1,152 @@
+package gomime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+func TestDecodeHeaderWithFallback(t *testing.T) {
+	koi8 := string(encodeTestText(t, "Привет, мир", "koi8-r"))
+	cp1251 := string(encodeTestText(t, detectRussian, "windows-1251"))
+	sjis := encodeTestText(t, "日本語", "shift_jis")
+
+	testData := []struct {
+		raw      string
+		charsets []string
+		expected string
+	}{
+		{"plain subject", nil, "plain subject"},
+		{"=?utf-8?q?J=C3=B6rg?= and =?utf-8?b?SsO2cmc=?=", nil, "Jörg and Jörg"},
+		// whitespace between encoded-words is ignored
+		{"=?utf-8?q?a?= \r\n =?iso-8859-1?q?b?=", nil, "ab"},
+		// raw 8-bit text in charset of the body
+		{"Re: " + koi8, []string{"koi8-r"}, "Re: Привет, мир"},
+		// unknown or unsuitable charsets are skipped
+		{koi8, []string{"", "x-unknown", "utf-8", "koi8-r"}, "Привет, мир"},
+		// detected charset
+		{cp1251, nil, detectRussian},
+		// encoded-word inside quoted string
+		{`"=?utf-8?q?J=C3=B6rg?=" <jorg@example.com>`, nil, `"Jörg" <jorg@example.com>`},
+		// character split between adjacent encoded-words
+		{"=?shift_jis?q?=" + hexByte(sjis[0]) + "?= =?shift_jis?q?=" + hexByte(sjis[1]) +
+			"=" + hexByte(sjis[2]) + "?= =?shift_jis?b?" + base64.StdEncoding.EncodeToString(sjis[3:]) + "?=", nil, "日本語"},
+		// malformed encoded-word stays as is
+		{"=?utf-8?b?!!!?= ok", nil, "=?utf-8?b?!!!?= ok"},
+		// mixed raw text and encoded-words
+		{koi8 + " =?utf-8?q?=E2=82=AC?=", []string{"koi8-r"}, "Привет, мир €"},
+	}
+
+	for _, val := range testData {
+		decoded, err := DecodeHeaderWithFallback(val.raw, val.charsets...)
+		if err != nil {
+			t.Errorf("unexpected error for %q: %v", val.raw, err)
+		}
+		if decoded != val.expected {
+			t.Errorf("expected %q but have %q", val.expected, decoded)
+		}
+	}
+
+	raw := "\x81\x8d\x8f\x90\x9d"
+	if decoded, err := DecodeHeaderWithFallback(raw, "utf-8"); err == nil || decoded != raw {
+		t.Errorf("expected error and raw value but have %q, %v", decoded, err)
+	}
+}
+
+func hexByte(c byte) string {
+	const digits = "0123456789ABCDEF"
+	return string([]byte{digits[c>>4], digits[c&0xf]})
+}
+
+func TestEncodeHeader(t *testing.T) {
+	testData := []struct {
+		value, expected string
+	}{
+		{"plain subject", "plain subject"},
+		{"Re: Jörg  said", "Re: =?utf-8?B?SsO2cmc=?=  said"},
+		{"Schönheitsköniginnen", "=?utf-8?Q?Sch=C3=B6nheitsk=C3=B6niginnen?="},
+		{"žluťoučký kůň", "=?utf-8?B?xb5sdcWlb3XEjWvDvSBrxa/FiA==?="},
+		{"日本語", "=?utf-8?B?5pel5pys6Kqe?="},
+		{"=?utf-8?q?fake?=", "=?utf-8?B?PT91dGYtOD9xP2Zha2U/PQ==?="},
+	}
+	for _, val := range testData {
+		if encoded := EncodeHeader(val.value); encoded != val.expected {
+			t.Errorf("expected %q but have %q", val.expected, encoded)
+		}
+	}
+
+	for _, value := range []string{
+		"Ça va? " + strings.Repeat("très bien ", 20),
+		strings.Repeat("日本語のテキスト", 20) + " end",
+		"a  ž  b ž  ",
+	} {
+		encoded := EncodeHeader(value)
+		for _, word := range strings.Fields(encoded) {
+			if len(word) > maxEncodedWordLength {
+				t.Errorf("too long encoded-word %q", word)
+			}
+		}
+		if decoded, err := DecodeHeader(encoded); err != nil || decoded != value {
+			t.Errorf("expected %q but have %q, %v", value, decoded, err)
+		}
+
+		buf := &bytes.Buffer{}
+		writeHeaderField(buf, "Subject", encoded)
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\r\n"), "\r\n") {
+			if len(line) > maxEncodedLineLength {
+				t.Errorf("line longer than %d: %q", maxEncodedLineLength, line)
+			}
+		}
+		msg, err := mail.ReadMessage(strings.NewReader(buf.String() + "\r\n"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decoded, _ := DecodeHeader(msg.Header.Get("Subject")); decoded != strings.TrimSpace(value) {
+			t.Errorf("folded header decoded as %q", decoded)
+		}
+	}
+}
+
+func TestEncodeAddressList(t *testing.T) {
+	addresses := []*mail.Address{
+		{Name: "Jörg Müller", Address: "jorg@example.com"},
+		{Name: "Doe, John", Address: "john@example.com"},
+		{Name: "Jane", Address: "jane@example.com"},
+		{Address: "anonymous@example.com"},
+	}
+	expected := `=?utf-8?B?SsO2cmcgTcO8bGxlcg==?= <jorg@example.com>, "Doe, John" <john@example.com>, ` +
+		`Jane <jane@example.com>, <anonymous@example.com>`
+	encoded := EncodeAddressList(addresses)
+	if encoded != expected {
+		t.Errorf("expected %q but have %q", expected, encoded)
+	}
+
+	parsed, err := (&mail.AddressParser{WordDecoder: wordDec}).ParseList(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, address := range parsed {
+		if *address != *addresses[i] {
+			t.Errorf("expected %v but have %v", addresses[i], address)
+		}
+	}
+
+	// non-ASCII To header passed as string keeps addresses intact
+	if value := encodeHeaderValue("to", "Jörg <jorg@example.com>, john@example.com"); value != `=?utf-8?B?SsO2cmc=?= <jorg@example.com>, <john@example.com>` {
+		t.Errorf("unexpected encoded address header %q", value)
+	}
+}
+
+func TestFormatMediaTypeWithEncodedWords(t *testing.T) {
+	params := map[string]string{"name": "Schönheitsköniginnen.pdf", "charset": "utf-8"}
+	formatted := FormatMediaTypeWithEncodedWords("application/pdf", params)
+	expected := `application/pdf; charset=utf-8; name="=?utf-8?Q?Sch=C3=B6nheitsk=C3=B6niginnen.pdf?="`
+	if formatted != expected {
+		t.Errorf("expected %q but have %q", expected, formatted)
+	}
+	if _, parsed, err := ParseMediaType(formatted); err != nil || parsed["name"] != params["name"] {
+		t.Errorf("unexpected parsed params %v, %v", parsed, err)
+	}
+}
@@ -0,0 +1,427 @@
+package gomime
+
+import (
+	"bytes"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Envelope is IMAP ENVELOPE structure (RFC 3501 section 7.4.2) of message.
+// String values are kept as they are in the header, Decode returns envelope
+// with decoded Subject. Addresses are parsed, so their names are decoded,
+// but String writes non-ASCII names of envelope which is not decoded as
+// encoded-words. Groups of address lists are written with group start and
+// end markers.
+type Envelope struct {
+	Date      string
+	Subject   string
+	From      *AddressList
+	Sender    *AddressList
+	ReplyTo   *AddressList
+	To        *AddressList
+	Cc        *AddressList
+	Bcc       *AddressList
+	InReplyTo string
+	MessageID string
+
+	// charset of body used for raw 8-bit subject
+	charset string
+	decoded bool
+}
+
+// NewEnvelope returns envelope of message with header h. Missing Sender and
+// Reply-To are set to From as required by RFC 3501.
+func NewEnvelope(h textproto.MIMEHeader) *Envelope {
+	_, params, _ := ParseMediaType(h.Get("Content-Type"))
+	env := &Envelope{
+		Date:      strings.TrimSpace(h.Get("Date")),
+		Subject:   h.Get("Subject"),
+		From:      parseAddressHeader(h, "From"),
+		Sender:    parseAddressHeader(h, "Sender"),
+		ReplyTo:   parseAddressHeader(h, "Reply-To"),
+		To:        parseAddressHeader(h, "To"),
+		Cc:        parseAddressHeader(h, "Cc"),
+		Bcc:       parseAddressHeader(h, "Bcc"),
+		InReplyTo: strings.TrimSpace(h.Get("In-Reply-To")),
+		MessageID: strings.TrimSpace(h.Get("Message-Id")),
+		charset:   params["charset"],
+	}
+	if env.Sender.isEmpty() {
+		env.Sender = env.From
+	}
+	if env.ReplyTo.isEmpty() {
+		env.ReplyTo = env.From
+	}
+	return env
+}
+
+// Decode returns copy of envelope with decoded Subject. Its String writes
+// non-ASCII values as UTF-8 literals, which should be sent only to clients
+// which enabled UTF8=ACCEPT (RFC 6855).
+func (env *Envelope) Decode() *Envelope {
+	decoded := *env
+	// legacy clients write raw subject in charset of the body
+	decoded.Subject, _ = DecodeHeaderWithFallback(env.Subject, env.charset)
+	decoded.decoded = true
+	return &decoded
+}
+
+// parseAddressHeader returns addresses and groups of header key,
+// unparsable fragments are skipped.
+func parseAddressHeader(h textproto.MIMEHeader, key string) *AddressList {
+	raw := strings.Join(h[textproto.CanonicalMIMEHeaderKey(key)], ", ")
+	return ParseAddressList(raw)
+}
+
+func (list *AddressList) isEmpty() bool {
+	return list == nil || (len(list.Addresses) == 0 && len(list.Groups) == 0)
+}
+
+// String returns envelope in IMAP syntax
+func (env *Envelope) String() string {
+	buf := &bytes.Buffer{}
+	env.writeTo(buf)
+	return buf.String()
+}
+
+func (env *Envelope) writeTo(buf *bytes.Buffer) {
+	buf.WriteByte('(')
+	writeIMAPNString(buf, env.Date)
+	buf.WriteByte(' ')
+	writeIMAPNString(buf, env.Subject)
+	for _, list := range []*AddressList{env.From, env.Sender, env.ReplyTo, env.To, env.Cc, env.Bcc} {
+		buf.WriteByte(' ')
+		writeIMAPAddressList(buf, list, env.decoded)
+	}
+	buf.WriteByte(' ')
+	writeIMAPNString(buf, env.InReplyTo)
+	buf.WriteByte(' ')
+	writeIMAPNString(buf, env.MessageID)
+	buf.WriteByte(')')
+}
+
+// BodyStructure is IMAP BODYSTRUCTURE (RFC 3501 section 7.4.2) in the
+// extended form. MediaType and MediaSubtype are lower case, other string
+// values are kept as they are in the header and Decode returns body
+// structure with decoded values. Parameters are parsed, so their values are
+// decoded, but String writes non-ASCII values of body structure which is not
+// decoded in RFC 2231 form.
+type BodyStructure struct {
+	MediaType    string
+	MediaSubtype string
+	Params       map[string]string
+
+	// Parts of multipart
+	Parts []*BodyStructure
+
+	// Fields of non-multipart
+	ID          string
+	Description string
+	Encoding    string
+	// Size is size of the body in octets as it is in the message
+	Size int64
+	// Lines is number of lines of text/* and message/rfc822 body
+	Lines int64
+	// Envelope and Body of message/rfc822 part
+	Envelope *Envelope
+	Body     *BodyStructure
+	MD5      string
+
+	// Extension data
+	Disposition       string
+	DispositionParams map[string]string
+	Language          []string
+	Location          string
+
+	decoded bool
+}
+
+// Envelope returns IMAP ENVELOPE of message with the part as the root
+func (p *Part) Envelope() *Envelope {
+	return NewEnvelope(p.Header)
+}
+
+// BodyStructure returns IMAP BODYSTRUCTURE of the part. Embedded message
+// which was not parsed has empty envelope and body.
+func (p *Part) BodyStructure() *BodyStructure {
+	bs := &BodyStructure{
+		Params:            p.MediaTypeParams,
+		Disposition:       p.Disposition,
+		DispositionParams: p.DispositionParams,
+		Location:          strings.TrimSpace(p.Header.Get("Content-Location")),
+	}
+	bs.MediaType, bs.MediaSubtype = splitMediaType(p.MediaType)
+	if p.Header.Get("Content-Type") == "" {
+		bs.Params = map[string]string{"charset": "us-ascii"}
+	}
+	for _, lang := range strings.Split(p.Header.Get("Content-Language"), ",") {
+		if lang = strings.TrimSpace(lang); lang != "" {
+			bs.Language = append(bs.Language, lang)
+		}
+	}
+
+	if strings.HasPrefix(p.MediaType, "multipart/") {
+		for _, child := range p.Children {
+			bs.Parts = append(bs.Parts, child.BodyStructure())
+		}
+		return bs
+	}
+
+	bs.ID = strings.TrimSpace(p.Header.Get("Content-Id"))
+	bs.Description = p.Header.Get("Content-Description")
+	bs.Encoding = p.TransferEncoding
+	if bs.Encoding == "" {
+		bs.Encoding = "7bit"
+	}
+	bs.Size = int64(len(p.rawBody))
+	bs.MD5 = strings.TrimSpace(p.Header.Get("Content-Md5"))
+
+	if bs.MediaType == "text" || isEmbeddedMessage(p.MediaType) {
+		bs.Lines = countLines(p.rawBody)
+	}
+	if isEmbeddedMessage(p.MediaType) {
+		if len(p.Children) == 1 {
+			bs.Envelope = p.Children[0].Envelope()
+			bs.Body = p.Children[0].BodyStructure()
+		} else {
+			bs.Envelope = NewEnvelope(textproto.MIMEHeader{})
+			bs.Body = emptyBodyStructure()
+		}
+	}
+	return bs
+}
+
+// Decode returns copy of body structure with decoded Description and
+// decoded envelopes of embedded messages. Its String writes non-ASCII values
+// as UTF-8 literals, which should be sent only to clients which enabled
+// UTF8=ACCEPT (RFC 6855).
+func (bs *BodyStructure) Decode() *BodyStructure {
+	decoded := *bs
+	if description, err := DecodeHeader(bs.Description); err == nil {
+		decoded.Description = description
+	}
+	decoded.Parts = nil
+	for _, part := range bs.Parts {
+		decoded.Parts = append(decoded.Parts, part.Decode())
+	}
+	if bs.Envelope != nil {
+		decoded.Envelope = bs.Envelope.Decode()
+	}
+	if bs.Body != nil {
+		decoded.Body = bs.Body.Decode()
+	}
+	decoded.decoded = true
+	return &decoded
+}
+
+// emptyBodyStructure returns body structure of empty text/plain part used
+// as placeholder for missing body
+func emptyBodyStructure() *BodyStructure {
+	return (&Part{Header: textproto.MIMEHeader{}, MediaType: "text/plain"}).BodyStructure()
+}
+
+func splitMediaType(mediaType string) (typ, subtype string) {
+	if i := strings.IndexByte(mediaType, '/'); i >= 0 {
+		return mediaType[:i], mediaType[i+1:]
+	}
+	return mediaType, ""
+}
+
+// countLines counts lines including the last one without line break
+func countLines(body []byte) int64 {
+	lines := int64(bytes.Count(body, []byte("\n")))
+	if len(body) > 0 && body[len(body)-1] != '\n' {
+		lines++
+	}
+	return lines
+}
+
+// String returns body structure in IMAP syntax
+func (bs *BodyStructure) String() string {
+	buf := &bytes.Buffer{}
+	bs.writeTo(buf)
+	return buf.String()
+}
+
+func (bs *BodyStructure) writeTo(buf *bytes.Buffer) {
+	buf.WriteByte('(')
+	if bs.MediaType == "multipart" {
+		for _, part := range bs.Parts {
+			part.writeTo(buf)
+		}
+		if len(bs.Parts) == 0 {
+			// IMAP requires at least one body of multipart
+			emptyBodyStructure().writeTo(buf)
+		}
+		buf.WriteByte(' ')
+		writeIMAPString(buf, strings.ToUpper(bs.MediaSubtype))
+		buf.WriteByte(' ')
+		writeIMAPParams(buf, bs.Params, bs.decoded)
+	} else {
+		writeIMAPString(buf, strings.ToUpper(bs.MediaType))
+		buf.WriteByte(' ')
+		writeIMAPString(buf, strings.ToUpper(bs.MediaSubtype))
+		buf.WriteByte(' ')
+		writeIMAPParams(buf, bs.Params, bs.decoded)
+		buf.WriteByte(' ')
+		writeIMAPNString(buf, bs.ID)
+		buf.WriteByte(' ')
+		writeIMAPNString(buf, bs.Description)
+		buf.WriteByte(' ')
+		writeIMAPString(buf, strings.ToUpper(bs.Encoding))
+		buf.WriteString(" " + strconv.FormatInt(bs.Size, 10))
+		if bs.Envelope != nil && bs.Body != nil {
+			buf.WriteByte(' ')
+			bs.Envelope.writeTo(buf)
+			buf.WriteByte(' ')
+			bs.Body.writeTo(buf)
+			buf.WriteString(" " + strconv.FormatInt(bs.Lines, 10))
+		} else if bs.MediaType == "text" {
+			buf.WriteString(" " + strconv.FormatInt(bs.Lines, 10))
+		}
+		buf.WriteByte(' ')
+		writeIMAPNString(buf, bs.MD5)
+	}
+
+	buf.WriteByte(' ')
+	if bs.Disposition == "" {
+		buf.WriteString("NIL")
+	} else {
+		buf.WriteByte('(')
+		writeIMAPString(buf, strings.ToUpper(bs.Disposition))
+		buf.WriteByte(' ')
+		writeIMAPParams(buf, bs.DispositionParams, bs.decoded)
+		buf.WriteByte(')')
+	}
+	buf.WriteByte(' ')
+	switch len(bs.Language) {
+	case 0:
+		buf.WriteString("NIL")
+	case 1:
+		writeIMAPString(buf, bs.Language[0])
+	default:
+		buf.WriteByte('(')
+		for i, lang := range bs.Language {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			writeIMAPString(buf, lang)
+		}
+		buf.WriteByte(')')
+	}
+	buf.WriteByte(' ')
+	writeIMAPNString(buf, bs.Location)
+	buf.WriteByte(')')
+}
+
+// writeIMAPParams writes parameter list sorted by name or NIL when empty.
+// Non-ASCII values are written in RFC 2231 form unless decoded is set.
+func writeIMAPParams(buf *bytes.Buffer, params map[string]string, decoded bool) {
+	if len(params) == 0 {
+		buf.WriteString("NIL")
+		return
+	}
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf.WriteByte('(')
+	for i, key := range keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		if value := params[key]; decoded || isASCII(value) {
+			writeIMAPString(buf, strings.ToUpper(key))
+			buf.WriteByte(' ')
+			writeIMAPString(buf, value)
+		} else {
+			writeIMAPString(buf, strings.ToUpper(key)+"*")
+			buf.WriteByte(' ')
+			writeIMAPString(buf, "utf-8''"+percentEncode(value))
+		}
+	}
+	buf.WriteByte(')')
+}
+
+// writeIMAPAddressList writes addresses in order of the list, groups
+// start by (NIL NIL "name" NIL) and end by (NIL NIL NIL NIL). Non-ASCII
+// names are written as encoded-words unless decoded is set.
+func writeIMAPAddressList(buf *bytes.Buffer, list *AddressList, decoded bool) {
+	if list.isEmpty() {
+		buf.WriteString("NIL")
+		return
+	}
+	encodeName := func(name string) string {
+		if !decoded && needsEncoding(name) {
+			return strings.Join(encodeWords(name, true), " ")
+		}
+		return name
+	}
+
+	buf.WriteByte('(')
+	groups := list.Groups
+	var group *AddressGroup
+	for i := 0; i <= len(list.Addresses); i++ {
+		if group != nil && i == group.Start+len(group.Addresses) {
+			buf.WriteString("(NIL NIL NIL NIL)")
+			group = nil
+		}
+		for group == nil && len(groups) > 0 && groups[0].Start <= i {
+			group, groups = groups[0], groups[1:]
+			buf.WriteString("(NIL NIL ")
+			writeIMAPNString(buf, encodeName(group.Name))
+			buf.WriteString(" NIL)")
+			if len(group.Addresses) == 0 {
+				buf.WriteString("(NIL NIL NIL NIL)")
+				group = nil
+			}
+		}
+		if i == len(list.Addresses) {
+			break
+		}
+
+		address := list.Addresses[i]
+		mailbox, host := address.Address, ""
+		if at := strings.LastIndexByte(mailbox, '@'); at >= 0 {
+			mailbox, host = mailbox[:at], mailbox[at+1:]
+		}
+		buf.WriteByte('(')
+		writeIMAPNString(buf, encodeName(address.Name))
+		buf.WriteString(" NIL ")
+		writeIMAPNString(buf, mailbox)
+		buf.WriteByte(' ')
+		writeIMAPNString(buf, host)
+		buf.WriteByte(')')
+	}
+	buf.WriteByte(')')
+}
+
+// writeIMAPNString writes NIL for empty string
+func writeIMAPNString(buf *bytes.Buffer, s string) {
+	if s == "" {
+		buf.WriteString("NIL")
+		return
+	}
+	writeIMAPString(buf, s)
+}
+
+// writeIMAPString writes quoted string, string which can not be quoted
+// (non-ASCII, CR or LF) is written as literal.
+func writeIMAPString(buf *bytes.Buffer, s string) {
+	if !isASCII(s) || strings.ContainsAny(s, "\r\n\x00") {
+		buf.WriteString("{" + strconv.Itoa(len(s)) + "}\r\n" + s)
+		return
+	}
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' || s[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(s[i])
+	}
+	buf.WriteByte('"')
+}
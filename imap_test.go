@@ -0,0 +1,167 @@
+package gomime
+
+import (
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestBodyStructure(t *testing.T) {
+	root, err := Parse(strings.NewReader(partTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	expected := `((` +
+		`("TEXT" "PLAIN" ("CHARSET" "utf-8") NIL NIL "QUOTED-PRINTABLE" 9 1 NIL NIL NIL NIL)` +
+		`("TEXT" "HTML" ("CHARSET" "utf-8") NIL NIL "7BIT" 12 1 NIL NIL NIL NIL)` +
+		` "ALTERNATIVE" ("BOUNDARY" "inner") NIL NIL NIL)` +
+		`("APPLICATION" "OCTET-STREAM" NIL NIL NIL "BASE64" 8 NIL ("ATTACHMENT" ("FILENAME" "data.bin")) NIL NIL)` +
+		` "MIXED" ("BOUNDARY" "outer") NIL NIL NIL)`
+	if bs := root.BodyStructure().String(); bs != expected {
+		t.Errorf("expected body structure\n%v\nbut have\n%v", expected, bs)
+	}
+}
+
+func TestBodyStructureEmbeddedMessage(t *testing.T) {
+	root, err := Parse(strings.NewReader(forwardedTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	message := root.BodyStructure().Parts[1]
+	if message.MediaType != "message" || message.MediaSubtype != "rfc822" {
+		t.Fatalf("unexpected media type %v/%v", message.MediaType, message.MediaSubtype)
+	}
+	if message.Lines != 16 || message.Size != 253 {
+		t.Errorf("unexpected lines %v and size %v", message.Lines, message.Size)
+	}
+	if message.Envelope == nil || message.Envelope.Subject != "report" {
+		t.Errorf("unexpected envelope %v", message.Envelope)
+	}
+	if message.Body == nil || len(message.Body.Parts) != 2 {
+		t.Fatalf("unexpected body %v", message.Body)
+	}
+
+	expected := `("MESSAGE" "GLOBAL" NIL NIL NIL "7BIT" 63 ` +
+		`(NIL "data" (("Carol" NIL "carol" "example.com")) (("Carol" NIL "carol" "example.com")) (("Carol" NIL "carol" "example.com")) NIL NIL NIL NIL NIL) ` +
+		`("TEXT" "PLAIN" ("CHARSET" "us-ascii") NIL NIL "7BIT" 13 1 NIL NIL NIL NIL) ` +
+		`4 NIL NIL NIL NIL)`
+	if bs := message.Body.Parts[1].String(); bs != expected {
+		t.Errorf("expected body structure\n%v\nbut have\n%v", expected, bs)
+	}
+}
+
+func TestBodyStructureEmptyMultipart(t *testing.T) {
+	root, err := Parse(strings.NewReader("Content-Type: multipart/mixed; boundary=b\r\n\r\n--b--\r\n"))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if len(root.Children) != 0 {
+		t.Fatalf("expected no children but have %d", len(root.Children))
+	}
+	expected := `(("TEXT" "PLAIN" ("CHARSET" "us-ascii") NIL NIL "7BIT" 0 0 NIL NIL NIL NIL) "MIXED" ("BOUNDARY" "b") NIL NIL NIL)`
+	if bs := root.BodyStructure().String(); bs != expected {
+		t.Errorf("expected body structure\n%q\nbut have\n%q", expected, bs)
+	}
+}
+
+func TestBodyStructureExtensionData(t *testing.T) {
+	root, err := Parse(strings.NewReader("Content-Type: text/plain; charset=utf-8; name*=utf-8''%C4%8D.txt\r\n" +
+		"Content-Id: <id@example.com>\r\n" +
+		"Content-Description: =?utf-8?q?popis_=C4=8D?=\r\n" +
+		"Content-Md5: Q2hlY2sgSW50ZWdyaXR5IQ==\r\n" +
+		"Content-Language: en, cs\r\n" +
+		"Content-Location: http://example.com/a.txt\r\n" +
+		"\r\n" +
+		"line\r\nlast line"))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	expected := `("TEXT" "PLAIN" ("CHARSET" "utf-8" "NAME*" "utf-8''%C4%8D.txt") "<id@example.com>" "=?utf-8?q?popis_=C4=8D?=" "7BIT" 15 2 ` +
+		`"Q2hlY2sgSW50ZWdyaXR5IQ==" NIL ("en" "cs") "http://example.com/a.txt")`
+	if bs := root.BodyStructure().String(); bs != expected {
+		t.Errorf("expected body structure\n%q\nbut have\n%q", expected, bs)
+	}
+
+	expected = `("TEXT" "PLAIN" ("CHARSET" "utf-8" "NAME" {6}` + "\r\n" + `č.txt) "<id@example.com>" {8}` + "\r\n" + `popis č "7BIT" 15 2 ` +
+		`"Q2hlY2sgSW50ZWdyaXR5IQ==" NIL ("en" "cs") "http://example.com/a.txt")`
+	if bs := root.BodyStructure().Decode().String(); bs != expected {
+		t.Errorf("expected decoded body structure\n%q\nbut have\n%q", expected, bs)
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	root, err := Parse(strings.NewReader("Date: Mon, 2 Jan 2006 15:04:05 -0700\r\n" +
+		"Subject: =?utf-8?q?=C5=BElu=C5=A5ou=C4=8Dk=C3=BD?= \"kůň\"\r\n" +
+		"From: =?utf-8?q?J=C3=B6hn?= <john@example.com>\r\n" +
+		"Reply-To: reply@example.com\r\n" +
+		"To: alice@example.com, \"Bob \\\"B\\\"\" <bob@example.com>\r\n" +
+		"Cc: broken <\r\n" +
+		"Message-Id: <id@example.com>\r\n" +
+		"In-Reply-To: <parent@example.com>\r\n" +
+		"\r\n" +
+		"body"))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	env := root.Envelope()
+	if env.Subject != `=?utf-8?q?=C5=BElu=C5=A5ou=C4=8Dk=C3=BD?= "kůň"` {
+		t.Errorf("unexpected raw subject %q", env.Subject)
+	}
+	if len(env.Sender.Addresses) != 1 || env.Sender.Addresses[0].Name != "Jöhn" {
+		t.Errorf("expected sender same as from but have %v", env.Sender.Addresses)
+	}
+	if len(env.Cc.Addresses) != 0 {
+		t.Errorf("expected no cc but have %v", env.Cc.Addresses)
+	}
+
+	expected := `("Mon, 2 Jan 2006 15:04:05 -0700" {49}` + "\r\n" + `=?utf-8?q?=C5=BElu=C5=A5ou=C4=8Dk=C3=BD?= "kůň" ` +
+		`(("=?utf-8?B?SsO2aG4=?=" NIL "john" "example.com")) (("=?utf-8?B?SsO2aG4=?=" NIL "john" "example.com")) ` +
+		`((NIL NIL "reply" "example.com")) ` +
+		`((NIL NIL "alice" "example.com")("Bob \"B\"" NIL "bob" "example.com")) ` +
+		`NIL NIL "<parent@example.com>" "<id@example.com>")`
+	if s := env.String(); s != expected {
+		t.Errorf("expected envelope\n%q\nbut have\n%q", expected, s)
+	}
+
+	decoded := env.Decode()
+	if decoded.Subject != `žluťoučký "kůň"` {
+		t.Errorf("unexpected subject %q", decoded.Subject)
+	}
+	expected = `("Mon, 2 Jan 2006 15:04:05 -0700" {21}` + "\r\n" + `žluťoučký "kůň" ` +
+		`(({5}` + "\r\n" + `Jöhn NIL "john" "example.com")) (({5}` + "\r\n" + `Jöhn NIL "john" "example.com")) ` +
+		`((NIL NIL "reply" "example.com")) ` +
+		`((NIL NIL "alice" "example.com")("Bob \"B\"" NIL "bob" "example.com")) ` +
+		`NIL NIL "<parent@example.com>" "<id@example.com>")`
+	if s := decoded.String(); s != expected {
+		t.Errorf("expected decoded envelope\n%q\nbut have\n%q", expected, s)
+	}
+}
+
+func TestEnvelopeGroups(t *testing.T) {
+	h := textproto.MIMEHeader{
+		"From": {"john@example.com"},
+		"To":   {"alice@example.com, Team: bob@example.com, \"Carol\" <carol@example.com>;, dave@example.com"},
+		"Cc":   {"undisclosed-recipients:;"},
+	}
+	expected := `(NIL NIL ((NIL NIL "john" "example.com")) ((NIL NIL "john" "example.com")) ((NIL NIL "john" "example.com")) ` +
+		`((NIL NIL "alice" "example.com")(NIL NIL "Team" NIL)(NIL NIL "bob" "example.com")("Carol" NIL "carol" "example.com")(NIL NIL NIL NIL)(NIL NIL "dave" "example.com")) ` +
+		`((NIL NIL "undisclosed-recipients" NIL)(NIL NIL NIL NIL)) ` +
+		`NIL NIL NIL)`
+	if s := NewEnvelope(h).String(); s != expected {
+		t.Errorf("expected envelope\n%q\nbut have\n%q", expected, s)
+	}
+}
+
+func TestEnvelopeRawSubject(t *testing.T) {
+	h := textproto.MIMEHeader{
+		"Subject":      {string(encodeTestText(t, "Привет", "koi8-r"))},
+		"Content-Type": {"text/plain; charset=koi8-r"},
+	}
+	if subject := NewEnvelope(h).Decode().Subject; subject != "Привет" {
+		t.Errorf("unexpected subject %q", subject)
+	}
+}
@@ -0,0 +1,153 @@
+package gomime
+
+import (
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/transform"
+)
+
+// ISO2022KR is RFC 1557 ISO-2022-KR encoding. Encoder supports only ASCII.
+var ISO2022KR encoding.Encoding = iso2022Encoding{
+	sets:       map[byte]encoding.Encoding{'C': korean.EUCKR},
+	initialSet: 'C',
+}
+
+// ISO2022CN is RFC 1922 ISO-2022-CN encoding. Only GB 2312 characters are
+// decoded, characters of CNS 11643 and ISO-IR-165 are replaced by U+FFFD.
+// Encoder supports only ASCII.
+var ISO2022CN encoding.Encoding = iso2022Encoding{
+	sets:           map[byte]encoding.Encoding{'A': simplifiedchinese.GBK, 'G': nil, 'E': nil},
+	resetAtLineEnd: true,
+}
+
+// iso2022Encoding decodes 7-bit ISO-2022 encodings which designate 94x94
+// character sets to shift out by `ESC $ ) F`
+type iso2022Encoding struct {
+	// sets are EUC encodings of character sets by final byte of
+	// designation, nil for sets which can not be decoded
+	sets map[byte]encoding.Encoding
+	// initialSet is designated at start, some mailers omit designation
+	initialSet byte
+	// resetAtLineEnd forgets designation and shift at the end of line
+	resetAtLineEnd bool
+}
+
+func (e iso2022Encoding) NewDecoder() *encoding.Decoder {
+	d := &iso2022Decoder{iso2022Encoding: e, decoders: map[byte]transform.Transformer{}}
+	for final, enc := range e.sets {
+		if enc != nil {
+			d.decoders[final] = enc.NewDecoder()
+		}
+	}
+	d.Reset()
+	return &encoding.Decoder{Transformer: d}
+}
+
+func (e iso2022Encoding) NewEncoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: asciiEncoder{}}
+}
+
+const (
+	iso2022Escape     = 0x1b
+	iso2022ShiftOut   = 0x0e
+	iso2022ShiftIn    = 0x0f
+	iso2022EscapeSize = 4
+)
+
+type iso2022Decoder struct {
+	iso2022Encoding
+	decoders map[byte]transform.Transformer
+	set      byte
+	shifted  bool
+	pair     [2]byte
+}
+
+func (d *iso2022Decoder) Reset() {
+	d.set, d.shifted = d.initialSet, false
+}
+
+func (d *iso2022Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if len(dst)-nDst < utf8.UTFMax {
+			return nDst, nSrc, transform.ErrShortDst
+		}
+		c, size := src[nSrc], 1
+		switch {
+		case c == iso2022Escape:
+			if len(src)-nSrc < iso2022EscapeSize && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			size = d.escape(src[nSrc:])
+			if size == 0 {
+				// unknown escape sequence is kept
+				dst[nDst], size = c, 1
+				nDst++
+			}
+			if size == 2 {
+				// single shift to unsupported set
+				nDst += copy(dst[nDst:], replacementRune)
+				size = iso2022EscapeSize
+			}
+		case c == iso2022ShiftOut:
+			d.shifted = true
+		case c == iso2022ShiftIn:
+			d.shifted = false
+		case d.shifted && c > ' ' && c < 0x7f:
+			if len(src)-nSrc < 2 && !atEOF {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			if len(src)-nSrc < 2 || src[nSrc+1] <= ' ' || src[nSrc+1] >= 0x7f {
+				nDst += copy(dst[nDst:], replacementRune)
+				break
+			}
+			size = 2
+			decoder := d.decoders[d.set]
+			if decoder == nil {
+				nDst += copy(dst[nDst:], replacementRune)
+				break
+			}
+			d.pair[0], d.pair[1] = c|0x80, src[nSrc+1]|0x80
+			decoder.Reset()
+			n, _, errPair := decoder.Transform(dst[nDst:], d.pair[:], true)
+			if errPair != nil {
+				n = copy(dst[nDst:], replacementRune)
+			}
+			nDst += n
+		case c >= utf8.RuneSelf:
+			nDst += copy(dst[nDst:], replacementRune)
+		default:
+			if c == '\n' && d.resetAtLineEnd {
+				d.Reset()
+			}
+			dst[nDst] = c
+			nDst++
+		}
+		nSrc += size
+	}
+	return
+}
+
+// escape handles escape sequence at the start of src and returns its size:
+// 4 for designation, 2 for single shift (followed by one character) and 0
+// for unknown sequence
+func (d *iso2022Decoder) escape(src []byte) int {
+	if len(src) < iso2022EscapeSize {
+		return 0
+	}
+	switch {
+	case src[1] == '$' && src[2] == ')':
+		if _, ok := d.sets[src[3]]; ok {
+			d.set = src[3]
+			return iso2022EscapeSize
+		}
+	case src[1] == '$' && (src[2] == '*' || src[2] == '+'):
+		// designation of single shift sets
+		return iso2022EscapeSize
+	case src[1] == 'N' || src[1] == 'O':
+		return 2
+	}
+	return 0
+}
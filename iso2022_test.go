@@ -0,0 +1,77 @@
+package gomime
+
+import (
+	"bytes"
+	"testing"
+)
+
+// iso2022Encode converts EUC encoded text to 7-bit ISO-2022 with designation
+func iso2022Encode(t *testing.T, text, euc, designation string) []byte {
+	encoded := encodeTestText(t, text, euc)
+	buf := bytes.NewBufferString(designation)
+	shifted := false
+	for _, c := range encoded {
+		if (c >= 0x80) != shifted {
+			shifted = !shifted
+			if shifted {
+				buf.WriteByte(iso2022ShiftOut)
+			} else {
+				buf.WriteByte(iso2022ShiftIn)
+			}
+		}
+		buf.WriteByte(c & 0x7f)
+	}
+	if shifted {
+		buf.WriteByte(iso2022ShiftIn)
+	}
+	return buf.Bytes()
+}
+
+func TestISO2022Decoders(t *testing.T) {
+	testData := []struct {
+		charset  string
+		encoded  []byte
+		expected string
+	}{
+		{"iso-2022-kr", iso2022Encode(t, detectKorean, "euc-kr", "\x1b$)C"), detectKorean},
+		// designation is missing
+		{"csISO2022KR", iso2022Encode(t, "한국어", "euc-kr", ""), "한국어"},
+		{"iso-2022-cn", iso2022Encode(t, detectChinese, "gb2312", "\x1b$)A"), detectChinese},
+		// CNS 11643 planes are not supported
+		{"iso-2022-cn", []byte("a\x1b$)G\x0e!!\x0fb\x1b$*H\x1bN!!c"), "a�b�c"},
+		// designation is forgotten at the end of line
+		{"iso-2022-cn", append(iso2022Encode(t, "中文", "gb2312", "\x1b$)A"), "\r\n\x0e!!\x0f"...), "中文\r\n�"},
+	}
+	for _, val := range testData {
+		decoded, err := DecodeCharset(val.encoded, "text/plain", map[string]string{"charset": val.charset})
+		if err != nil || string(decoded) != val.expected {
+			t.Errorf("%v: expected %q but have %q, %v", val.charset, val.expected, decoded, err)
+		}
+	}
+
+	if _, err := EncodeCharset([]byte("한국어"), "iso-2022-kr"); err == nil {
+		t.Error("expected error for non-ascii text")
+	}
+	if encoded, err := EncodeCharset([]byte("plain"), "iso-2022-cn"); err != nil || string(encoded) != "plain" {
+		t.Errorf("unexpected encoded %q, %v", encoded, err)
+	}
+}
+
+func TestDetectISO2022(t *testing.T) {
+	testData := []struct {
+		charset, text string
+		encoded       []byte
+	}{
+		{"iso-2022-kr", detectKorean, iso2022Encode(t, detectKorean, "euc-kr", "\x1b$)C")},
+		{"iso-2022-cn", detectChinese, iso2022Encode(t, detectChinese, "gb2312", "\x1b$)A")},
+	}
+	for _, val := range testData {
+		if charset, confidence := DetectCharset(val.encoded); charset != val.charset || confidence != 1 {
+			t.Errorf("expected %v but have %v (confidence %v)", val.charset, charset, confidence)
+		}
+		// 7-bit text without charset is not taken as UTF-8
+		if decoded, err := DecodeCharset(val.encoded, "text/plain", map[string]string{}); err != nil || string(decoded) != val.text {
+			t.Errorf("%v: unexpected decoded text %q, %v", val.charset, decoded, err)
+		}
+	}
+}
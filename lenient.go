@@ -0,0 +1,161 @@
+package gomime
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// LenientDecoder decodes transfer encoding without failing on malformed
+// input. Repaired returns the number of input bytes which were skipped or
+// fixed so far.
+type LenientDecoder interface {
+	io.Reader
+	Repaired() int
+}
+
+// base64Values maps characters of standard and URL-safe base64 alphabets to
+// their values, other characters are -1
+var base64Values = func() (values [256]int8) {
+	for i := range values {
+		values[i] = -1
+	}
+	for i, c := range "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/" {
+		values[c] = int8(i)
+	}
+	values['-'], values['_'] = 62, 63
+	return
+}()
+
+type lenientBase64Decoder struct {
+	r        io.Reader
+	in       [4096]byte
+	out      []byte
+	quantum  [4]byte
+	n        int
+	err      error
+	repaired int
+}
+
+// NewLenientBase64Decoder returns base64 decoder which skips invalid
+// characters, accepts URL-safe alphabet, missing padding and data after
+// padding (e.g. concatenated base64 blocks).
+func NewLenientBase64Decoder(r io.Reader) LenientDecoder {
+	return &lenientBase64Decoder{r: r}
+}
+
+func (d *lenientBase64Decoder) Repaired() int {
+	return d.repaired
+}
+
+func (d *lenientBase64Decoder) Read(p []byte) (n int, err error) {
+	for len(d.out) == 0 && d.err == nil {
+		var m int
+		m, d.err = d.r.Read(d.in[:])
+		for _, c := range d.in[:m] {
+			d.decodeByte(c)
+		}
+		if d.err == io.EOF {
+			if d.n > 1 {
+				// missing padding
+				d.repaired += 4 - d.n
+			}
+			d.flush()
+		}
+	}
+	n = copy(p, d.out)
+	if d.out = d.out[n:]; len(d.out) == 0 && n == 0 {
+		err = d.err
+	}
+	return
+}
+
+func (d *lenientBase64Decoder) decodeByte(c byte) {
+	switch value := base64Values[c]; {
+	case value >= 0:
+		d.quantum[d.n] = byte(value)
+		if d.n++; d.n == 4 {
+			d.flush()
+		}
+	case c == '=':
+		// padding ends quantum, extra padding is ignored
+		d.flush()
+	case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+	default:
+		d.repaired++
+	}
+}
+
+// flush writes decoded bytes of complete or partial quantum
+func (d *lenientBase64Decoder) flush() {
+	q := d.quantum
+	switch d.n {
+	case 1:
+		// single character does not carry whole byte
+		d.repaired++
+	case 2:
+		d.out = append(d.out, q[0]<<2|q[1]>>4)
+	case 3:
+		d.out = append(d.out, q[0]<<2|q[1]>>4, q[1]<<4|q[2]>>2)
+	case 4:
+		d.out = append(d.out, q[0]<<2|q[1]>>4, q[1]<<4|q[2]>>2, q[2]<<6|q[3])
+	}
+	d.n = 0
+}
+
+type lenientQuotedPrintableDecoder struct {
+	r        *bufio.Reader
+	out      []byte
+	err      error
+	repaired int
+}
+
+// NewLenientQuotedPrintableDecoder returns quoted-printable decoder which
+// keeps invalid escapes and lone '=' as they are, accepts lower case hex
+// digits and raw 8-bit bytes and ignores whitespace before line break.
+func NewLenientQuotedPrintableDecoder(r io.Reader) LenientDecoder {
+	return &lenientQuotedPrintableDecoder{r: bufio.NewReader(r)}
+}
+
+func (d *lenientQuotedPrintableDecoder) Repaired() int {
+	return d.repaired
+}
+
+func (d *lenientQuotedPrintableDecoder) Read(p []byte) (n int, err error) {
+	for len(d.out) == 0 && d.err == nil {
+		var line []byte
+		line, d.err = d.r.ReadBytes('\n')
+		d.decodeLine(line)
+	}
+	n = copy(p, d.out)
+	if d.out = d.out[n:]; len(d.out) == 0 && n == 0 {
+		err = d.err
+	}
+	return
+}
+
+func (d *lenientQuotedPrintableDecoder) decodeLine(line []byte) {
+	content := bytes.TrimRight(line, "\r\n")
+	lineBreak := line[len(content):]
+	content = bytes.TrimRight(content, " \t")
+
+	if bytes.HasSuffix(content, []byte("=")) {
+		// soft line break
+		content, lineBreak = content[:len(content)-1], nil
+	}
+	for i := 0; i < len(content); i++ {
+		c := content[i]
+		if c != '=' {
+			d.out = append(d.out, c)
+			continue
+		}
+		if i+2 < len(content) && isHex(content[i+1]) && isHex(content[i+2]) {
+			d.out = append(d.out, unhex(content[i+1])<<4|unhex(content[i+2]))
+			i += 2
+			continue
+		}
+		d.out = append(d.out, c)
+		d.repaired++
+	}
+	d.out = append(d.out, lineBreak...)
+}
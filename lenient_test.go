@@ -0,0 +1,114 @@
+package gomime
+
+import (
+	"io/ioutil"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestLenientBase64Decoder(t *testing.T) {
+	testData := []struct {
+		encoded, decoded string
+		repaired         int
+	}{
+		{"SGVsbG8gd29ybGQ=", "Hello world", 0},
+		{"SGVs\r\nbG8g\r\nd29y bGQ=\r\n", "Hello world", 0},
+		// missing padding
+		{"SGVsbG8gd29ybGQ", "Hello world", 1},
+		// stray characters
+		{"SGV*sbG8g!d29ybGQ=", "Hello world", 2},
+		// URL-safe alphabet
+		{"-_-_", "\xfb\xff\xbf", 0},
+		// data after padding
+		{"SGk=SGk=", "HiHi", 0},
+		// dangling character
+		{"SGk=S", "Hi", 1},
+	}
+	for _, val := range testData {
+		decoder := NewLenientBase64Decoder(strings.NewReader(val.encoded))
+		decoded, err := ioutil.ReadAll(decoder)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", val.encoded, err)
+		}
+		if string(decoded) != val.decoded || decoder.Repaired() != val.repaired {
+			t.Errorf("%q: expected %q (%d repaired) but have %q (%d repaired)", val.encoded, val.decoded, val.repaired, decoded, decoder.Repaired())
+		}
+	}
+}
+
+func TestLenientQuotedPrintableDecoder(t *testing.T) {
+	testData := []struct {
+		encoded, decoded string
+		repaired         int
+	}{
+		{"caf=C3=A9\r\n", "café\r\n", 0},
+		{"caf=c3=a9", "café", 0},
+		// soft line break and whitespace before line break
+		{"long =  \r\nline  \r\nnext\n", "long line\r\nnext\n", 0},
+		// lone and invalid escapes
+		{"1+1=2 and =ZZ\r\n", "1+1=2 and =ZZ\r\n", 2},
+		{"end =4", "end =4", 1},
+		// raw 8-bit bytes
+		{"café", "café", 0},
+	}
+	for _, val := range testData {
+		decoder := NewLenientQuotedPrintableDecoder(strings.NewReader(val.encoded))
+		decoded, err := ioutil.ReadAll(decoder)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", val.encoded, err)
+		}
+		if string(decoded) != val.decoded || decoder.Repaired() != val.repaired {
+			t.Errorf("%q: expected %q (%d repaired) but have %q (%d repaired)", val.encoded, val.decoded, val.repaired, decoded, decoder.Repaired())
+		}
+	}
+}
+
+func TestRepairWarnings(t *testing.T) {
+	message := "Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"1+1=2\r\n" +
+		"--b\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: Base64\r\n" +
+		"\r\n" +
+		"AAEC*AwQF\r\n" +
+		"--b--\r\n"
+
+	mm, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagnostics := NewDiagnostics()
+	plainTextCollector := NewPlainTextCollector(NewMIMEPrinter())
+	plainTextCollector.SetDiagnostics(diagnostics)
+	attachmentsCollector := NewAttachmentsCollector(plainTextCollector)
+	attachmentsCollector.SetDiagnostics(diagnostics)
+	visitor := NewMimeVisitor(attachmentsCollector)
+	visitor.SetDiagnostics(diagnostics)
+	if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+		t.Fatal("visit error", err)
+	}
+
+	var warnings []string
+	for _, w := range diagnostics.Warnings {
+		warnings = append(warnings, w.String())
+	}
+	expected := "part 1: bad quoted-printable: repaired 1 malformed bytes\n" +
+		"part 2: bad base64: repaired 1 malformed bytes"
+	if strings.Join(warnings, "\n") != expected {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+	if plain := plainTextCollector.GetPlainText(); plain != "1+1=2" {
+		t.Errorf("unexpected plain text %q", plain)
+	}
+	attachments := attachmentsCollector.GetAttachments()
+	if len(attachments) != 1 || string(attachments[0]) != "\x00\x01\x02\x03\x04\x05" {
+		t.Errorf("unexpected attachments %q", attachments)
+	}
+}
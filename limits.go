@@ -0,0 +1,195 @@
+package gomime
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/textproto"
+)
+
+// Limits bounds resources used while processing untrusted message. Zero
+// value of any field means no limit.
+//
+// Byte limits of parts are applied to content after transfer decoding,
+// which can be much larger than the raw content (e.g. run-length encoding of
+// BinHex). Acceptors which read leaf content without collectors of this
+// package are limited by its raw size. Content read in advance, i.e. whole
+// message by Parse, multiparts by buffered MimeVisitor and embedded
+// messages, is limited by MaxTotalBytes as well.
+//
+// Header limits are checked after the header was read. MimeVisitor gets
+// headers parsed by mime/multipart and net/mail, so a huge header is read
+// into memory before it is rejected; only MaxTotalBytes of content read in
+// advance bounds it. ParseWithLimits checks the raw header before parsing
+// it, but the whole message is read first.
+type Limits struct {
+	// MaxDepth is maximal nesting of multiparts and embedded messages. The
+	// top-level part has depth 0.
+	MaxDepth int
+	// MaxParts is maximal number of parts including containers.
+	MaxParts int
+	// MaxHeaderBytes is maximal size of header block of one part.
+	MaxHeaderBytes int
+	// MaxHeaderFields is maximal number of header fields of one part.
+	MaxHeaderFields int
+	// MaxHeaderLineLength is maximal length of one header line.
+	MaxHeaderLineLength int
+	// MaxPartBytes is maximal size of content of one leaf part.
+	MaxPartBytes int64
+	// MaxTotalBytes is maximal size of content of all leaf parts.
+	MaxTotalBytes int64
+}
+
+// LimitError is returned when message exceeds one of Limits
+type LimitError struct {
+	// Limit is name of exceeded field of Limits
+	Limit string
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("gomime: message exceeds %s limit %d", e.Limit, e.Max)
+}
+
+// limiter checks limits and counts parts and bytes of one message
+type limiter struct {
+	Limits
+	parts int
+	total int64
+}
+
+func newLimiter(limits Limits) *limiter {
+	return &limiter{Limits: limits}
+}
+
+func (l *limiter) checkDepth(depth int) error {
+	if l.MaxDepth > 0 && depth > l.MaxDepth {
+		return &LimitError{"MaxDepth", int64(l.MaxDepth)}
+	}
+	return nil
+}
+
+func (l *limiter) addPart() error {
+	if l.parts++; l.MaxParts > 0 && l.parts > l.MaxParts {
+		return &LimitError{"MaxParts", int64(l.MaxParts)}
+	}
+	return nil
+}
+
+// checkHeader checks header which was already read and parsed. The header
+// block size and line length are estimated from unfolded fields.
+func (l *limiter) checkHeader(h textproto.MIMEHeader) error {
+	fields, size := 0, 0
+	for key, values := range h {
+		for _, value := range values {
+			line := len(key) + len(": ") + len(value)
+			if l.MaxHeaderLineLength > 0 && line > l.MaxHeaderLineLength {
+				return &LimitError{"MaxHeaderLineLength", int64(l.MaxHeaderLineLength)}
+			}
+			fields++
+			size += line + len("\r\n")
+		}
+	}
+	return l.checkHeaderSize(fields, size)
+}
+
+// checkRawHeader checks header block as it is in the message
+func (l *limiter) checkRawHeader(raw []byte) error {
+	fields := 0
+	for _, line := range bytes.Split(bytes.TrimRight(raw, "\r\n"), []byte("\n")) {
+		line = bytes.TrimRight(line, "\r")
+		if l.MaxHeaderLineLength > 0 && len(line) > l.MaxHeaderLineLength {
+			return &LimitError{"MaxHeaderLineLength", int64(l.MaxHeaderLineLength)}
+		}
+		if len(line) > 0 && line[0] != ' ' && line[0] != '\t' {
+			fields++
+		}
+	}
+	return l.checkHeaderSize(fields, len(raw))
+}
+
+func (l *limiter) checkHeaderSize(fields, size int) error {
+	if l.MaxHeaderFields > 0 && fields > l.MaxHeaderFields {
+		return &LimitError{"MaxHeaderFields", int64(l.MaxHeaderFields)}
+	}
+	if l.MaxHeaderBytes > 0 && size > l.MaxHeaderBytes {
+		return &LimitError{"MaxHeaderBytes", int64(l.MaxHeaderBytes)}
+	}
+	return nil
+}
+
+func (l *limiter) checkPartSize(size int64) error {
+	if l.MaxPartBytes > 0 && size > l.MaxPartBytes {
+		return &LimitError{"MaxPartBytes", l.MaxPartBytes}
+	}
+	return nil
+}
+
+func (l *limiter) addTotal(n int64) error {
+	if l.total += n; l.MaxTotalBytes > 0 && l.total > l.MaxTotalBytes {
+		return &LimitError{"MaxTotalBytes", l.MaxTotalBytes}
+	}
+	return nil
+}
+
+// partReader returns reader which fails with LimitError when leaf content
+// exceeds limits
+func (l *limiter) partReader(r io.Reader) *limitedReader {
+	return &limitedReader{r: r, l: l, isLeaf: true}
+}
+
+// containerReader returns reader which fails with LimitError when content
+// of container read in advance (multipart by buffered visitor or embedded
+// message) exceeds total limit. It is not counted to the total of leaves.
+func (l *limiter) containerReader(r io.Reader) *limitedReader {
+	return &limitedReader{r: r, l: &limiter{Limits: Limits{MaxTotalBytes: l.MaxTotalBytes}}}
+}
+
+type limitedReader struct {
+	r      io.Reader
+	l      *limiter
+	isLeaf bool
+	read   int64
+	err    error
+	// raw is leaf reader of content decoded by this reader
+	raw *limitedReader
+}
+
+// decodeLeaf returns content of part decoded by decode. Limits of leaf
+// reader are applied to the decoded content instead of the raw one, raw
+// content read from the leaf after decoding is counted to the same part.
+func decodeLeaf(part io.Reader, decode func(io.Reader) io.Reader) io.Reader {
+	raw, ok := part.(*limitedReader)
+	if !ok || !raw.isLeaf {
+		return decode(part)
+	}
+	return &limitedReader{r: decode(raw.r), l: raw.l, isLeaf: true, read: raw.read, raw: raw}
+}
+
+func (lr *limitedReader) Read(b []byte) (n int, err error) {
+	if lr.err != nil {
+		return 0, lr.err
+	}
+	n, err = lr.r.Read(b)
+	lr.read += int64(n)
+	if lr.isLeaf {
+		lr.err = lr.l.checkPartSize(lr.read)
+	}
+	if lr.err == nil {
+		lr.err = lr.l.addTotal(int64(n))
+	}
+	if lr.raw != nil {
+		// the acceptor can ignore error of decoded content
+		lr.raw.read, lr.raw.err = lr.read, lr.err
+	}
+	if lr.err != nil {
+		return n, lr.err
+	}
+	return
+}
+
+// isLimitError returns true for errors which must stop processing
+func isLimitError(err error) bool {
+	_, ok := err.(*LimitError)
+	return ok
+}
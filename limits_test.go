@@ -0,0 +1,142 @@
+package gomime
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// nestedTestMessage returns message with multiparts nested to depth
+func nestedTestMessage(depth int) string {
+	body := "Content-Type: text/plain\r\n\r\nbottom"
+	for i := depth; i > 0; i-- {
+		body = fmt.Sprintf("Content-Type: multipart/mixed; boundary=b%d\r\n\r\n--b%d\r\n%s\r\n--b%d--\r\n", i, i, body, i)
+	}
+	return "Subject: nested\r\n" + body
+}
+
+func expectLimitError(t *testing.T, name string, err error, limit string) {
+	t.Helper()
+	if limitErr, ok := err.(*LimitError); !ok || limitErr.Limit != limit {
+		t.Errorf("%s: expected %s LimitError but have %v", name, limit, err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	testData := []struct {
+		message string
+		limits  Limits
+		limit   string
+	}{
+		{nestedTestMessage(5), Limits{MaxDepth: 4}, "MaxDepth"},
+		{nestedTestMessage(5), Limits{MaxParts: 5}, "MaxParts"},
+		{nestedTestMessage(1), Limits{MaxHeaderFields: 1}, "MaxHeaderFields"},
+		{nestedTestMessage(1), Limits{MaxHeaderLineLength: 20}, "MaxHeaderLineLength"},
+		{nestedTestMessage(1), Limits{MaxHeaderBytes: 30}, "MaxHeaderBytes"},
+		{partTestMessage, Limits{MaxPartBytes: 5}, "MaxPartBytes"},
+		{partTestMessage, Limits{MaxTotalBytes: 20}, "MaxTotalBytes"},
+	}
+
+	visitors := map[string]func(VisitAcceptor) *MimeVisitor{
+		"buffered":  NewMimeVisitor,
+		"streaming": NewStreamingMimeVisitor,
+	}
+	for _, val := range testData {
+		for name, newVisitor := range visitors {
+			_, _, _, err := collectWithVisitor(val.message, func(target VisitAcceptor) *MimeVisitor {
+				visitor := newVisitor(target)
+				visitor.SetLimits(val.limits)
+				return visitor
+			})
+			expectLimitError(t, name+" visitor", err, val.limit)
+		}
+
+		_, err := ParseWithLimits(strings.NewReader(val.message), val.limits)
+		expectLimitError(t, "parse", err, val.limit)
+	}
+}
+
+func TestLimitsNotExceeded(t *testing.T) {
+	limits := Limits{
+		MaxDepth:            5,
+		MaxParts:            6,
+		MaxHeaderBytes:      100,
+		MaxHeaderFields:     2,
+		MaxHeaderLineLength: 60,
+		MaxPartBytes:        6,
+		MaxTotalBytes:       1000,
+	}
+	message := nestedTestMessage(5)
+
+	plain, _, _, err := collectWithVisitor(message, func(target VisitAcceptor) *MimeVisitor {
+		visitor := NewStreamingMimeVisitor(target)
+		visitor.SetLimits(limits)
+		return visitor
+	})
+	if err != nil || plain != "bottom" {
+		t.Errorf("unexpected plain text %q and error %v", plain, err)
+	}
+
+	if _, err := ParseWithLimits(strings.NewReader(message), limits); err != nil {
+		t.Error("unexpected parse error", err)
+	}
+}
+
+func TestLimitsEmbeddedMessage(t *testing.T) {
+	_, err := ParseWithLimits(strings.NewReader(forwardedTestMessage), Limits{MaxDepth: 1})
+	expectLimitError(t, "parse", err, "MaxDepth")
+
+	_, _, _, err = collectWithVisitor(forwardedTestMessage, func(target VisitAcceptor) *MimeVisitor {
+		visitor := NewMimeVisitor(target)
+		visitor.SetDescendMessages(true)
+		visitor.SetLimits(Limits{MaxDepth: 1})
+		return visitor
+	})
+	expectLimitError(t, "visitor", err, "MaxDepth")
+}
+
+func TestLimitsDecodedContent(t *testing.T) {
+	visitors := map[string]func(VisitAcceptor) *MimeVisitor{
+		"buffered":  NewMimeVisitor,
+		"streaming": NewStreamingMimeVisitor,
+	}
+	visit := func(message string, limits Limits, newVisitor func(VisitAcceptor) *MimeVisitor) error {
+		_, _, _, err := collectWithVisitor(message, func(target VisitAcceptor) *MimeVisitor {
+			visitor := newVisitor(target)
+			visitor.SetLimits(limits)
+			return visitor
+		})
+		return err
+	}
+
+	// small raw content expanded by run-length encoding
+	expanded := "Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nbody\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\nContent-Transfer-Encoding: x-binhex\r\n\r\n" +
+		binhex(make([]byte, 1<<20)) + "--b--\r\n"
+	limits := Limits{MaxPartBytes: 1 << 16, MaxTotalBytes: 1 << 16}
+	for name, newVisitor := range visitors {
+		expectLimitError(t, name+" visitor", visit(expanded, limits, newVisitor), "MaxPartBytes")
+	}
+	_, err := ParseWithLimits(strings.NewReader(expanded), limits)
+	expectLimitError(t, "parse", err, "MaxPartBytes")
+
+	// decoded content is smaller than the raw one
+	encoded := "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: base64\r\n\r\nY2Fmw6k=\r\n"
+	limits = Limits{MaxPartBytes: 5, MaxTotalBytes: 200}
+	for name, newVisitor := range visitors {
+		if err := visit(encoded, limits, newVisitor); err != nil {
+			t.Errorf("%v visitor: unexpected error %v", name, err)
+		}
+	}
+	if _, err := ParseWithLimits(strings.NewReader(encoded), limits); err != nil {
+		t.Error("parse: unexpected error", err)
+	}
+}
+
+func TestLimitsEncodedEmbeddedMessage(t *testing.T) {
+	message := "Content-Type: message/rfc822\r\nContent-Transfer-Encoding: x-binhex\r\n\r\n" +
+		binhex(append([]byte("Subject: expanded\r\n\r\n"), make([]byte, 1<<20)...))
+	_, err := ParseWithLimits(strings.NewReader(message), Limits{MaxTotalBytes: 1 << 16})
+	expectLimitError(t, "parse", err, "MaxTotalBytes")
+}
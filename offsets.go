@@ -0,0 +1,52 @@
+package gomime
+
+import "io"
+
+// Range is half-open range [Start, End) of bytes in the original message
+type Range struct {
+	Start, End int64
+}
+
+// Size returns number of bytes in range
+func (r Range) Size() int64 {
+	return r.End - r.Start
+}
+
+// Reader returns reader of the range of original message ra
+func (r Range) Reader(ra io.ReaderAt) *io.SectionReader {
+	return io.NewSectionReader(ra, r.Start, r.Size())
+}
+
+func (r Range) shift(offset int64) Range {
+	return Range{r.Start + offset, r.End + offset}
+}
+
+// Offsets are byte offsets of part in the original message passed to Parse
+type Offsets struct {
+	// Header is the header block including the empty line terminating it
+	Header Range
+	// Body is the rest of the part after header
+	Body Range
+	// Boundaries are delimiter lines of multipart body including the line
+	// break preceding the delimiter and the line break terminating it. The
+	// last one is the close delimiter unless it is missing.
+	Boundaries []Range
+}
+
+// HeaderReader returns reader of raw header block of the part from original
+// message ra. It returns nil when offsets of the part are not known.
+func (p *Part) HeaderReader(ra io.ReaderAt) *io.SectionReader {
+	if p.Offsets == nil {
+		return nil
+	}
+	return p.Offsets.Header.Reader(ra)
+}
+
+// BodyReader returns reader of raw body of the part from original message
+// ra. It returns nil when offsets of the part are not known.
+func (p *Part) BodyReader(ra io.ReaderAt) *io.SectionReader {
+	if p.Offsets == nil {
+		return nil
+	}
+	return p.Offsets.Body.Reader(ra)
+}
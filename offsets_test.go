@@ -0,0 +1,78 @@
+package gomime
+
+import (
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPartOffsets(t *testing.T) {
+	for _, message := range []string{partTestMessage, forwardedTestMessage} {
+		root, err := Parse(strings.NewReader(message))
+		if err != nil {
+			t.Fatal("parse error", err)
+		}
+		original := strings.NewReader(message)
+
+		_ = root.Walk(func(p *Part) error {
+			if p.Offsets == nil {
+				t.Errorf("missing offsets of part %v", p.Section())
+				return nil
+			}
+			if header, _ := ioutil.ReadAll(p.HeaderReader(original)); string(header) != string(p.rawHeader) {
+				t.Errorf("unexpected header of part %v: %q", p.Section(), header)
+			}
+			if body, _ := ioutil.ReadAll(p.BodyReader(original)); string(body) != string(p.rawBody) {
+				t.Errorf("unexpected body of part %v: %q", p.Section(), body)
+			}
+			if p.Offsets.Body.Start != p.Offsets.Header.End || p.Offsets.Body.Size() != int64(len(p.rawBody)) {
+				t.Errorf("unexpected offsets of part %v: %+v", p.Section(), p.Offsets)
+			}
+			return nil
+		})
+	}
+
+	root, _ := Parse(strings.NewReader(partTestMessage))
+	expected := []string{"\r\n--outer\r\n", "\r\n--outer\r\n", "\r\n--outer--\r\n"}
+	if len(root.Offsets.Boundaries) != len(expected) {
+		t.Fatalf("unexpected boundaries %v", root.Offsets.Boundaries)
+	}
+	for i, boundary := range root.Offsets.Boundaries {
+		if data := partTestMessage[boundary.Start:boundary.End]; data != expected[i] {
+			t.Errorf("expected boundary %q but have %q", expected[i], data)
+		}
+	}
+
+	// boundaries and parts cover the whole multipart body
+	children := root.Children
+	for i, child := range children {
+		if child.Offsets.Header.Start != root.Offsets.Boundaries[i].End {
+			t.Errorf("part %v does not start after delimiter", child.Section())
+		}
+		if child.Offsets.Body.End != root.Offsets.Boundaries[i+1].Start {
+			t.Errorf("part %v does not end at delimiter", child.Section())
+		}
+	}
+}
+
+func TestPartOffsetsDecodedMessage(t *testing.T) {
+	message := "Content-Type: message/rfc822\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte("Subject: hidden\r\n\r\ntext"))
+
+	root, err := Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if root.Offsets == nil || root.Offsets.Body.End != int64(len(message)) {
+		t.Errorf("unexpected offsets of message part %+v", root.Offsets)
+	}
+	if len(root.Children) != 1 || root.Children[0].Offsets != nil {
+		t.Error("expected embedded message without offsets")
+	}
+	if reader := root.Children[0].BodyReader(strings.NewReader(message)); reader != nil {
+		t.Error("expected nil reader of part without offsets")
+	}
+}
@@ -0,0 +1,299 @@
+package gomime
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxParamSectionLength limits the length of RFC 2231 parameter section
+// so that folded header lines stay short
+const maxParamSectionLength = 60
+
+// ErrNoMediaType is returned by ParseMediaType for value without media type
+var ErrNoMediaType = errors.New("mime: no media type")
+
+// paramSection is one RFC 2231 section of parameter value
+type paramSection struct {
+	index    int
+	extended bool
+	value    string
+}
+
+// ParseMediaType parses Content-Type or Content-Disposition value. It is
+// lenient version of mime.ParseMediaType which additionally
+//   - joins RFC 2231 continuations (name*0*=, name*1*=, ...),
+//   - converts RFC 2231 values from their charset using charset aliases
+//     known to DecodeCharset,
+//   - decodes RFC 2047 encoded-words inside parameter values (non-standard
+//     but common form name="=?utf-8?B?...?="),
+//   - skips malformed parameters instead of failing.
+//
+// The media type and parameter names are lower case.
+func ParseMediaType(v string) (mediaType string, params map[string]string, err error) {
+	mediaType = v
+	rest := ""
+	if i := strings.IndexByte(v, ';'); i >= 0 {
+		mediaType, rest = v[:i], v[i+1:]
+	}
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	if mediaType == "" || strings.IndexFunc(mediaType, isNotMediaTypeChar) >= 0 {
+		return "", nil, ErrNoMediaType
+	}
+
+	plain := map[string]string{}
+	sections := map[string][]paramSection{}
+	for rest != "" {
+		var key, value string
+		if key, value, rest = consumeParam(rest); key == "" {
+			continue
+		}
+		if strings.Contains(key, "*") {
+			if name, section, ok := parseSectionKey(key, value); ok {
+				sections[name] = append(sections[name], section)
+				continue
+			}
+		}
+		if _, ok := plain[key]; !ok {
+			plain[key] = value
+		}
+	}
+
+	params = map[string]string{}
+	for key, value := range plain {
+		if strings.Contains(value, "=?") {
+			if decoded, err := DecodeHeader(value); err == nil {
+				value = decoded
+			}
+		}
+		params[key] = value
+	}
+	for name, nameSections := range sections {
+		params[name] = joinSections(nameSections)
+	}
+	return mediaType, params, nil
+}
+
+func isNotMediaTypeChar(r rune) bool {
+	return r != '/' && !isTokenChar(r)
+}
+
+// isTokenChar as defined in RFC 2045
+func isTokenChar(r rune) bool {
+	return r > 0x20 && r < 0x7f && !strings.ContainsRune("()<>@,;:\\\"/[]?=", r)
+}
+
+// consumeParam reads one `key=value` from v and returns the rest after
+// separator. Empty key is returned for malformed parameter.
+func consumeParam(v string) (key, value, rest string) {
+	v = strings.TrimLeft(v, " \t\r\n")
+	eq := strings.IndexByte(v, '=')
+	semicolon := strings.IndexByte(v, ';')
+	if eq < 0 || (semicolon >= 0 && semicolon < eq) {
+		if semicolon < 0 {
+			return "", "", ""
+		}
+		return "", "", v[semicolon+1:]
+	}
+	key = strings.ToLower(strings.TrimSpace(v[:eq]))
+	v = strings.TrimLeft(v[eq+1:], " \t\r\n")
+
+	if strings.HasPrefix(v, "\"") {
+		buf := &bytes.Buffer{}
+		i := 1
+		for ; i < len(v) && v[i] != '"'; i++ {
+			if v[i] == '\\' && i+1 < len(v) {
+				i++
+			}
+			buf.WriteByte(v[i])
+		}
+		if i < len(v) {
+			i++ // closing quote
+		}
+		value, rest = buf.String(), v[i:]
+		if semicolon = strings.IndexByte(rest, ';'); semicolon >= 0 {
+			rest = rest[semicolon+1:]
+		} else {
+			rest = ""
+		}
+	} else if semicolon = strings.IndexByte(v, ';'); semicolon >= 0 {
+		value, rest = strings.TrimSpace(v[:semicolon]), v[semicolon+1:]
+	} else {
+		value = strings.TrimSpace(v)
+	}
+
+	if strings.IndexFunc(key, isNotTokenChar) >= 0 {
+		key = ""
+	}
+	return
+}
+
+func isNotTokenChar(r rune) bool {
+	return !isTokenChar(r)
+}
+
+// parseSectionKey parses RFC 2231 key `name*`, `name*N` or `name*N*`
+func parseSectionKey(key, value string) (name string, section paramSection, ok bool) {
+	section.value = value
+	if strings.HasSuffix(key, "*") {
+		section.extended = true
+		key = key[:len(key)-1]
+	}
+	star := strings.IndexByte(key, '*')
+	if star < 0 {
+		return key, section, section.extended
+	}
+	index, err := strconv.Atoi(key[star+1:])
+	if err != nil || index < 0 {
+		return
+	}
+	section.index = index
+	return key[:star], section, true
+}
+
+// joinSections decodes and joins RFC 2231 sections. The charset is taken
+// from the first section.
+func joinSections(sections []paramSection) string {
+	sort.SliceStable(sections, func(i, j int) bool {
+		return sections[i].index < sections[j].index
+	})
+
+	charset := ""
+	buf := &bytes.Buffer{}
+	for i, section := range sections {
+		if !section.extended {
+			buf.WriteString(section.value)
+			continue
+		}
+		value := section.value
+		if i == 0 {
+			if parts := strings.SplitN(value, "'", 3); len(parts) == 3 {
+				charset, value = parts[0], parts[2]
+			}
+		}
+		buf.Write(percentDecode(value))
+	}
+
+	if charset != "" {
+		if decoder, err := selectDecoder(charset); err == nil && decoder != nil {
+			if decoded, err := decoder.Bytes(buf.Bytes()); err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	return buf.String()
+}
+
+// percentDecode decodes %XX escapes, invalid escapes are kept
+func percentDecode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]) {
+			b = append(b, unhex(s[i+1])<<4|unhex(s[i+2]))
+			i += 2
+			continue
+		}
+		b = append(b, s[i])
+	}
+	return b
+}
+
+func isHex(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+// unhex returns value of hex digit
+func unhex(c byte) byte {
+	switch {
+	case c >= 'a':
+		return c - 'a' + 10
+	case c >= 'A':
+		return c - 'A' + 10
+	}
+	return c - '0'
+}
+
+// FormatMediaType serializes media type and parameters. ASCII values are
+// written as tokens or quoted strings. Non-ASCII values, values with line
+// breaks and long values are written in RFC 2231 form with UTF-8 charset, split into continuations
+// when needed. Parameters are sorted by name. Empty string is returned for
+// invalid media type or parameter name.
+func FormatMediaType(mediaType string, params map[string]string) string {
+	mediaType = strings.ToLower(mediaType)
+	if mediaType == "" || strings.IndexFunc(mediaType, isNotMediaTypeChar) >= 0 {
+		return ""
+	}
+
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key == "" || strings.IndexFunc(key, isNotTokenChar) >= 0 {
+			return ""
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(mediaType)
+	for _, key := range keys {
+		value := params[key]
+		key = strings.ToLower(key)
+		if isASCII(value) && !strings.ContainsAny(value, "\r\n") && len(value) <= maxParamSectionLength {
+			buf.WriteString("; " + key + "=" + quoteParamValue(value))
+			continue
+		}
+		for i, section := range splitParamValue("utf-8''" + percentEncode(value)) {
+			buf.WriteString("; " + key + "*" + strconv.Itoa(i) + "*=" + section)
+		}
+	}
+	return buf.String()
+}
+
+func quoteParamValue(value string) string {
+	if value != "" && strings.IndexFunc(value, isNotTokenChar) < 0 {
+		return value
+	}
+	buf := &bytes.Buffer{}
+	buf.WriteByte('"')
+	for i := 0; i < len(value); i++ {
+		if value[i] == '"' || value[i] == '\\' {
+			buf.WriteByte('\\')
+		}
+		buf.WriteByte(value[i])
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// percentEncode escapes all bytes which are not RFC 2231 attribute-char
+func percentEncode(value string) string {
+	const hex = "0123456789ABCDEF"
+	buf := &bytes.Buffer{}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if c < utf8.RuneSelf && isTokenChar(rune(c)) && c != '*' && c != '\'' && c != '%' {
+			buf.WriteByte(c)
+			continue
+		}
+		buf.WriteByte('%')
+		buf.WriteByte(hex[c>>4])
+		buf.WriteByte(hex[c&0xf])
+	}
+	return buf.String()
+}
+
+// splitParamValue splits percent-encoded value without breaking escapes
+func splitParamValue(value string) (sections []string) {
+	for len(value) > maxParamSectionLength {
+		end := maxParamSectionLength
+		if i := strings.LastIndexByte(value[end-2:end], '%'); i >= 0 {
+			end = end - 2 + i
+		}
+		sections = append(sections, value[:end])
+		value = value[end:]
+	}
+	return append(sections, value)
+}
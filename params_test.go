@@ -0,0 +1,102 @@
+package gomime
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseMediaType(t *testing.T) {
+	testData := []struct {
+		raw, mediaType string
+		params         map[string]string
+	}{
+		{
+			`text/plain; charset="UTF-8"; format=flowed`,
+			"text/plain",
+			map[string]string{"charset": "UTF-8", "format": "flowed"},
+		},
+		{
+			`Attachment; FileName*0*=utf-8''%C5%BElu%C5%A5ou%C4%8Dk%C3%BD; filename*1*=%20k%C5%AF%C5%88.txt`,
+			"attachment",
+			map[string]string{"filename": "žluťoučký kůň.txt"},
+		},
+		{
+			`attachment; filename*=koi8-r'ru'%C1%DA%C2%D5%CB%C1.txt; filename="fallback.txt"`,
+			"attachment",
+			map[string]string{"filename": "азбука.txt"},
+		},
+		{
+			`attachment; filename*=cp1250''%E1%E4%E8.pdf`,
+			"attachment",
+			map[string]string{"filename": "áäč.pdf"},
+		},
+		{
+			`application/pdf; name*0="very long "; name*1="file name.pdf"`,
+			"application/pdf",
+			map[string]string{"name": "very long file name.pdf"},
+		},
+		{
+			`image/jpeg; name="=?utf-8?B?xb5sdcWlb3XEjWvDvS5qcGc=?="`,
+			"image/jpeg",
+			map[string]string{"name": "žluťoučký.jpg"},
+		},
+		{
+			`multipart/mixed; ; broken; boundary="a;b"; =value`,
+			"multipart/mixed",
+			map[string]string{"boundary": "a;b"},
+		},
+		{
+			`text/html; name="with \"quotes\""`,
+			"text/html",
+			map[string]string{"name": `with "quotes"`},
+		},
+	}
+
+	for _, val := range testData {
+		mediaType, params, err := ParseMediaType(val.raw)
+		if err != nil {
+			t.Error("unexpected error for", val.raw, err)
+			continue
+		}
+		if mediaType != val.mediaType {
+			t.Errorf("expected media type %q but have %q", val.mediaType, mediaType)
+		}
+		if len(params) != len(val.params) {
+			t.Errorf("expected params %v but have %v", val.params, params)
+		}
+		for key, expected := range val.params {
+			if params[key] != expected {
+				t.Errorf("expected %v=%q but have %q for %v", key, expected, params[key], val.raw)
+			}
+		}
+	}
+
+	if _, _, err := ParseMediaType("; charset=utf-8"); err != ErrNoMediaType {
+		t.Error("expected ErrNoMediaType but have", err)
+	}
+}
+
+func TestFormatMediaType(t *testing.T) {
+	if formatted := FormatMediaType("Text/Plain", map[string]string{"Charset": "utf-8", "name": "a b.txt"}); formatted != `text/plain; charset=utf-8; name="a b.txt"` {
+		t.Error("unexpected formatted media type", formatted)
+	}
+
+	filename := strings.Repeat("Příliš žluťoučký kůň ", 5) + ".txt"
+	formatted := FormatMediaType("attachment", map[string]string{"filename": filename})
+	if !strings.Contains(formatted, "filename*0*=utf-8''") || !strings.Contains(formatted, "filename*1*=") {
+		t.Error("expected RFC 2231 continuations but have", formatted)
+	}
+	for _, section := range strings.Split(formatted, "; ") {
+		if len(section) > maxParamSectionLength+len("filename*10*=") {
+			t.Error("too long section", section)
+		}
+	}
+
+	if _, params, _ := ParseMediaType(formatted); params["filename"] != filename {
+		t.Errorf("expected round trip of %q but have %q", filename, params["filename"])
+	}
+
+	if formatted := FormatMediaType("text/plain", map[string]string{"bad key": "value"}); formatted != "" {
+		t.Error("expected empty string for invalid parameter name but have", formatted)
+	}
+}
@@ -3,15 +3,13 @@ package gomime
 import (
 	"bufio"
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
-	"log"
-	"mime"
 	"mime/multipart"
 	"net/http"
 	"net/mail"
 	"net/textproto"
-	"regexp"
 	"strings"
 )
 
@@ -29,13 +27,87 @@ func VisitAll(part io.Reader, h textproto.MIMEHeader, accepter VisitAcceptor) (e
 	return accepter.Accept(part, h, mediaType == "text/plain", true, true)
 }
 
+// MessageAcceptor can be implemented by VisitAcceptor which wants to know
+// about messages embedded as message/rfc822 or message/global parts. When
+// MimeVisitor descends into embedded message it calls EnterMessage with the
+// header of the enclosing part, the top-level header of the embedded message
+// and the depth of embedding (1 for message attached to the visited one).
+// Then the embedded message is visited as a part with messageHeader and
+// LeaveMessage is called at the end.
+type MessageAcceptor interface {
+	EnterMessage(partHeader, messageHeader textproto.MIMEHeader, depth int) (err error)
+	LeaveMessage(depth int) (err error)
+}
+
+func enterMessage(target VisitAcceptor, partHeader, messageHeader textproto.MIMEHeader, depth int) error {
+	if ma, ok := target.(MessageAcceptor); ok {
+		return ma.EnterMessage(partHeader, messageHeader, depth)
+	}
+	return nil
+}
+
+func leaveMessage(target VisitAcceptor, depth int) error {
+	if ma, ok := target.(MessageAcceptor); ok {
+		return ma.LeaveMessage(depth)
+	}
+	return nil
+}
+
+// SectionAcceptor can be implemented by VisitAcceptor which wants to know
+// where in the message tree the accepted part is. MimeVisitor calls
+// SetSection with IMAP section path (e.g. "2.1") of the part before each
+// call of Accept. The top-level multipart of message has empty section.
+type SectionAcceptor interface {
+	SetSection(section string)
+}
+
+func setSection(target VisitAcceptor, section string) {
+	if sa, ok := target.(SectionAcceptor); ok {
+		sa.SetSection(section)
+	}
+}
+
 func IsLeaf(h textproto.MIMEHeader) bool {
 	return !strings.HasPrefix(h.Get("Content-Type"), "multipart/")
 }
 
+// isEmbeddedMessage returns true for media types of parts which contain
+// whole message (RFC 2046 and RFC 6532)
+func isEmbeddedMessage(mediaType string) bool {
+	return mediaType == "message/rfc822" || mediaType == "message/global"
+}
+
 // MIMEVisitor is main object to parse (visit) and process (accept) all parts of MIME message
 type MimeVisitor struct {
-	target VisitAcceptor
+	target          VisitAcceptor
+	streaming       bool
+	descendMessages bool
+	depth           int
+	diagnostics     *Diagnostics
+	limits          Limits
+	limiter         *limiter
+	level           int
+}
+
+// SetDescendMessages enables visiting of messages embedded as
+// message/rfc822 or message/global parts. Such part is not passed to
+// acceptor as a leaf, instead the embedded message is visited and acceptors
+// implementing MessageAcceptor are notified about it.
+func (mv *MimeVisitor) SetDescendMessages(descend bool) {
+	mv.descendMessages = descend
+}
+
+// SetDiagnostics sets where warnings found while visiting are reported. The
+// same diagnostics should be set to collectors, so that their warnings
+// carry the section of visited part.
+func (mv *MimeVisitor) SetDiagnostics(d *Diagnostics) {
+	mv.diagnostics = d
+}
+
+// SetLimits bounds resources used while visiting message. When a limit is
+// exceeded the visitor stops with LimitError.
+func (mv *MimeVisitor) SetLimits(limits Limits) {
+	mv.limits = limits
 }
 
 // Accept reads part recursively if needed
@@ -44,48 +116,227 @@ func (mv *MimeVisitor) Accept(part io.Reader, h textproto.MIMEHeader, hasPlainSi
 	if !isFirst {
 		return
 	}
+	mv.limiter, mv.level = newLimiter(mv.limits), 0
+	return mv.visit(part, h, hasPlainSibling, nil, true)
+}
 
+// visit accepts part and its children. The top-level part of message has
+// the section of the message; when it is not multipart it gets section 1 as
+// defined by IMAP.
+func (mv *MimeVisitor) visit(part io.Reader, h textproto.MIMEHeader, hasPlainSibling bool, section []int, isMessage bool) (err error) {
+	if err = mv.checkLimits(h); err != nil {
+		return
+	}
 	parentMediaType, params, err := getContentType(h)
 	if err != nil {
 		return
 	}
 
+	if mv.descendMessages && isEmbeddedMessage(parentMediaType) {
+		return mv.visitMessage(part, h, hasPlainSibling, section)
+	}
+
+	if isMessage && IsLeaf(h) {
+		section = appendSection(section, 1)
+	}
+	mv.setSection(section)
+	if IsLeaf(h) {
+		return mv.acceptLeaf(part, h, hasPlainSibling)
+	}
 	if err = mv.target.Accept(part, h, hasPlainSibling, true, false); err != nil {
 		return
 	}
 
-	if !IsLeaf(h) {
-		var multiparts []io.Reader
-		var multipartHeaders []textproto.MIMEHeader
-		if multiparts, multipartHeaders, err = GetMultipartParts(part, params); err != nil {
+	mv.level++
+	defer func() { mv.level-- }()
+	if mv.streaming {
+		return mv.visitMultipartStream(part, h, parentMediaType, params, hasPlainSibling, section)
+	}
+	var multiparts []io.Reader
+	var multipartHeaders []textproto.MIMEHeader
+	if multiparts, multipartHeaders, err = getMultipartParts(part, params, mv.diagnostics, mv.limiter); err != nil {
+		return
+	}
+	hasPlainChild := false
+	for _, header := range multipartHeaders {
+		mediaType, _, _ := getContentType(header)
+		if mediaType == "text/plain" {
+			hasPlainChild = true
+		}
+	}
+	if hasPlainSibling && parentMediaType == "multipart/related" {
+		hasPlainChild = true
+	}
+
+	for i, p := range multiparts {
+		if err = mv.visit(p, multipartHeaders[i], hasPlainChild, appendSection(section, i+1), false); err != nil {
 			return
 		}
-		hasPlainChild := false
-		for _, header := range multipartHeaders {
-			mediaType, _, _ := getContentType(header)
-			if mediaType == "text/plain" {
-				hasPlainChild = true
-			}
+		mv.setSection(section)
+		if err = mv.target.Accept(part, h, hasPlainSibling, false, i == (len(multiparts)-1)); err != nil {
+			return
 		}
-		if hasPlainSibling && parentMediaType == "multipart/related" {
+	}
+	return
+}
+
+// acceptLeaf passes leaf part to target
+func (mv *MimeVisitor) acceptLeaf(part io.Reader, h textproto.MIMEHeader, hasPlainSibling bool) (err error) {
+	leaf := mv.limiter.partReader(part)
+	if err = mv.target.Accept(leaf, h, hasPlainSibling, true, false); err == nil {
+		err = leaf.err // acceptor could ignore read error
+	}
+	return
+}
+
+// setSection passes section of visited part to diagnostics and target
+func (mv *MimeVisitor) setSection(section []int) {
+	mv.diagnostics.setSection(section)
+	setSection(mv.target, formatSection(section))
+}
+
+// checkLimits checks limits of visited part
+func (mv *MimeVisitor) checkLimits(h textproto.MIMEHeader) (err error) {
+	if err = mv.limiter.checkDepth(mv.level); err != nil {
+		return
+	}
+	if err = mv.limiter.addPart(); err != nil {
+		return
+	}
+	return mv.limiter.checkHeader(h)
+}
+
+// visitMessage visits message embedded in part. Message which can not be
+// parsed is reported and accepted as a leaf.
+func (mv *MimeVisitor) visitMessage(part io.Reader, h textproto.MIMEHeader, hasPlainSibling bool, section []int) (err error) {
+	mv.setSection(section)
+	recorder := &recordingReader{r: part, record: &bytes.Buffer{}}
+	content := mv.limiter.containerReader(recorder)
+	msg, err := mail.ReadMessage(decodePart(content, h, mv.diagnostics))
+	if content.err != nil {
+		return content.err
+	}
+	var mediaType string
+	if err == nil {
+		mediaType, _, err = getContentType(textproto.MIMEHeader(msg.Header))
+	}
+	if err != nil {
+		mv.diagnostics.warn(WarningBadEmbeddedMessage, err)
+		return mv.acceptLeaf(io.MultiReader(bytes.NewReader(recorder.record.Bytes()), part), h, hasPlainSibling)
+	}
+	recorder.record = nil
+	msgHeader := textproto.MIMEHeader(msg.Header)
+
+	mv.depth++
+	mv.level++
+	defer func() {
+		mv.depth--
+		mv.level--
+	}()
+
+	if err = enterMessage(mv.target, h, msgHeader, mv.depth); err != nil {
+		return
+	}
+	if err = mv.visit(msg.Body, msgHeader, mediaType == "text/plain", section, true); err != nil {
+		return
+	}
+	if content.err != nil {
+		return content.err
+	}
+	mv.setSection(section)
+	return leaveMessage(mv.target, mv.depth)
+}
+
+// visitMultipartStream visits children of multipart directly from the
+// multipart reader without reading siblings in advance. The reader of each
+// child is valid only until the acceptor returns.
+func (mv *MimeVisitor) visitMultipartStream(part io.Reader, h textproto.MIMEHeader, mediaType string, params map[string]string, hasPlainSibling bool, section []int) (err error) {
+	mr := multipart.NewReader(part, params["boundary"])
+	hasPlainChild := hasPlainSibling && mediaType == "multipart/related"
+
+	p, err := mr.NextRawPart()
+	for i := 1; err == nil; i++ {
+		if childMediaType, _, _ := getContentType(p.Header); childMediaType == "text/plain" {
 			hasPlainChild = true
 		}
+		child := &truncationReader{r: p}
+		if err = mv.visit(child, p.Header, hasPlainChild, appendSection(section, i), false); err != nil {
+			return
+		}
+		_, _ = io.Copy(ioutil.Discard, child) // skip the rest not read by acceptor
 
-		for i, p := range multiparts {
-			if err = mv.Accept(p, multipartHeaders[i], hasPlainChild, true, true); err != nil {
-				return
-			}
-			if err = mv.target.Accept(part, h, hasPlainSibling, false, i == (len(multiparts)-1)); err != nil {
-				return
-			}
+		var next *multipart.Part
+		if child.truncated {
+			mv.setSection(section)
+			mv.diagnostics.warn(WarningMissingBoundaryTerminator, nil)
+		} else if next, err = mr.NextRawPart(); err != nil && err != io.EOF {
+			return
 		}
+		mv.setSection(section)
+		if err = mv.target.Accept(part, h, hasPlainSibling, false, next == nil); err != nil {
+			return
+		}
+		if next == nil {
+			return
+		}
+		p = next
+	}
+	if err == io.EOF {
+		err = nil
+	}
+	return
+}
+
+// recordingReader keeps data read until record is set to nil
+type recordingReader struct {
+	r      io.Reader
+	record *bytes.Buffer
+}
+
+func (rr *recordingReader) Read(b []byte) (n int, err error) {
+	n, err = rr.r.Read(b)
+	if rr.record != nil {
+		rr.record.Write(b[:n])
 	}
 	return
 }
 
+// truncationReader remembers whether multipart part ended without
+// delimiter
+type truncationReader struct {
+	r         io.Reader
+	truncated bool
+}
+
+func (tr *truncationReader) Read(b []byte) (n int, err error) {
+	n, err = tr.r.Read(b)
+	if err == io.ErrUnexpectedEOF {
+		tr.truncated = true
+	}
+	return
+}
+
+func appendSection(section []int, index int) []int {
+	return append(append([]int{}, section...), index)
+}
+
 // NewMIMEVisitor initialiazed with acceptor
 func NewMimeVisitor(targetAccepter VisitAcceptor) *MimeVisitor {
-	return &MimeVisitor{targetAccepter}
+	return &MimeVisitor{target: targetAccepter}
+}
+
+// NewStreamingMimeVisitor initialiazed with acceptor. The visitor does not
+// buffer siblings in advance: each part reader passed to acceptor reads
+// directly from the underlying multipart reader and is valid only until
+// Accept returns. This limits memory only for acceptors which read the
+// part reader directly: BodyCollector, PlainTextCollector and
+// AttachmentsCollector still read each leaf they collect into memory and
+// pass it to their target as a buffered reader.
+// Following siblings are not known in advance, therefore hasPlainSibling is
+// true only when some text/plain sibling was already visited (or it is the
+// text/plain part itself).
+func NewStreamingMimeVisitor(targetAccepter VisitAcceptor) *MimeVisitor {
+	return &MimeVisitor{target: targetAccepter, streaming: true}
 }
 
 func GetRawMimePart(rawdata io.Reader, boundary string) (io.Reader, io.Reader) {
@@ -175,7 +426,19 @@ func GetAllChildParts(part io.Reader, h textproto.MIMEHeader) (parts []io.Reader
 }
 
 func GetMultipartParts(r io.Reader, params map[string]string) (parts []io.Reader, headers []textproto.MIMEHeader, err error) {
-	mr := multipart.NewReader(r, params["boundary"])
+	return getMultipartParts(r, params, nil, newLimiter(Limits{}))
+}
+
+// getMultipartParts reads all parts. Multipart without close delimiter
+// ends with the last part and it is reported to d.
+func getMultipartParts(r io.Reader, params map[string]string, d *Diagnostics, l *limiter) (parts []io.Reader, headers []textproto.MIMEHeader, err error) {
+	content := l.containerReader(r)
+	defer func() {
+		if content.err != nil {
+			err = content.err
+		}
+	}()
+	mr := multipart.NewReader(content, params["boundary"])
 	parts = []io.Reader{}
 	headers = []textproto.MIMEHeader{}
 	var p *multipart.Part
@@ -188,11 +451,15 @@ func GetMultipartParts(r io.Reader, params map[string]string) (parts []io.Reader
 		if err != nil {
 			return
 		}
-		b, _ := ioutil.ReadAll(p)
+		b, errRead := ioutil.ReadAll(p)
 		buffer := bytes.NewBuffer(b)
 
 		parts = append(parts, buffer)
 		headers = append(headers, p.Header)
+		if errRead == io.ErrUnexpectedEOF {
+			d.warn(WarningMissingBoundaryTerminator, nil)
+			break
+		}
 	}
 	return
 }
@@ -230,29 +497,6 @@ func pickAlternativePart(parts []io.Reader, headers []textproto.MIMEHeader) (par
 	return
 }
 
-// Parse address comment as defined in http://tools.wordtothewise.com/rfc/822
-// FIXME: Does not work for address groups
-// NOTE: This should be removed for go>1.10 (please check)
-func parseAddressComment(raw string) string {
-	parsed := []string{}
-	for _, item := range regexp.MustCompile("[,;]").Split(raw, -1) {
-		re := regexp.MustCompile("[(][^)]*[)]")
-		comments := strings.Join(re.FindAllString(item, -1), " ")
-		comments = strings.Replace(comments, "(", "", -1)
-		comments = strings.Replace(comments, ")", "", -1)
-		withoutComments := re.ReplaceAllString(item, "")
-		addr, err := mail.ParseAddress(withoutComments)
-		if err != nil {
-			continue
-		}
-		if addr.Name == "" {
-			addr.Name = comments
-		}
-		parsed = append(parsed, addr.String())
-	}
-	return strings.Join(parsed, ", ")
-}
-
 func checkHeaders(headers []textproto.MIMEHeader) bool {
 	foundAttachment := false
 
@@ -271,15 +515,113 @@ func checkHeaders(headers []textproto.MIMEHeader) bool {
 	return false
 }
 
-func decodePart(partReader io.Reader, header textproto.MIMEHeader) (decodedPart io.Reader) {
+func decodePart(partReader io.Reader, header textproto.MIMEHeader, d *Diagnostics) (decodedPart io.Reader) {
 	decodedPart = DecodeContentEncoding(partReader, header.Get("Content-Transfer-Encoding"))
 	if decodedPart == nil {
-		log.Printf("Unsupported Content-Transfer-Encoding '%v'", header.Get("Content-Transfer-Encoding"))
+		d.warn(WarningUnknownTransferEncoding, fmt.Errorf("unsupported Content-Transfer-Encoding '%v'", header.Get("Content-Transfer-Encoding")))
 		decodedPart = partReader
 	}
+	if lenient, ok := decodedPart.(LenientDecoder); ok && d != nil {
+		decodedPart = &repairReporter{LenientDecoder: lenient, contentEncoding: header.Get("Content-Transfer-Encoding"), d: d}
+	}
 	return
 }
 
+// repairReporter warns about bytes repaired by lenient decoder when the
+// whole part was read
+type repairReporter struct {
+	LenientDecoder
+	contentEncoding string
+	d               *Diagnostics
+	reported        bool
+}
+
+func (rr *repairReporter) Read(p []byte) (n int, err error) {
+	n, err = rr.LenientDecoder.Read(p)
+	if err == io.EOF && !rr.reported {
+		rr.reported = true
+		if repaired := rr.Repaired(); repaired > 0 {
+			rr.d.warnTransferEncoding(rr.contentEncoding, fmt.Errorf("repaired %d malformed bytes", repaired))
+		}
+	}
+	return
+}
+
+// readPart reads the raw part and decodes its transfer encoding in one pass
+// so the raw data are not copied once more before decoding.
+func readPart(partReader io.Reader, header textproto.MIMEHeader, d *Diagnostics) (raw, decoded []byte, err error) {
+	rawBuffer := &bytes.Buffer{}
+	decoded, err = ioutil.ReadAll(decodeLeaf(partReader, func(r io.Reader) io.Reader {
+		return decodePart(io.TeeReader(r, rawBuffer), header, d)
+	}))
+	if err != nil && !isLimitError(err) {
+		d.warnTransferEncoding(header.Get("Content-Transfer-Encoding"), err)
+	}
+	// decoder can stop before the end of part (e.g. base64 padding)
+	if _, errRead := rawBuffer.ReadFrom(partReader); err == nil {
+		err = errRead
+	}
+	return rawBuffer.Bytes(), decoded, err
+}
+
+// errorReader remembers the first error of underlying reader other than EOF
+type errorReader struct {
+	r   io.Reader
+	err error
+}
+
+func (er *errorReader) Read(p []byte) (n int, err error) {
+	n, err = er.r.Read(p)
+	if err != nil && err != io.EOF && er.err == nil {
+		er.err = err
+	}
+	return
+}
+
+// readTextPart streams the part decoded from its transfer encoding and
+// charset to w and returns the raw part. The raw part is kept in memory
+// because collectors pass it to their target. When the part cannot be decoded
+// nothing is written. When only the charset cannot be decoded, text decoded
+// from transfer encoding is written as readPart with decodeCharset would do.
+func readTextPart(partReader io.Reader, header textproto.MIMEHeader, w *bytes.Buffer, d *Diagnostics) (raw []byte, err error) {
+	mediaType, params, _ := getContentType(header)
+	start := w.Len()
+	rawBuffer := &bytes.Buffer{}
+	transferDecoded := &errorReader{r: decodeLeaf(partReader, func(r io.Reader) io.Reader {
+		return decodePart(io.TeeReader(r, rawBuffer), header, d)
+	})}
+	_, err = io.Copy(w, d.decodeCharsetReader(transferDecoded, mediaType, params))
+	switch {
+	case err == nil:
+	case transferDecoded.err != nil:
+		err = transferDecoded.err
+		if !isLimitError(err) {
+			d.warnTransferEncoding(header.Get("Content-Transfer-Encoding"), err)
+		}
+		w.Truncate(start)
+	default:
+		d.warnCharset(params, err)
+		w.Truncate(start)
+		if _, err = rawBuffer.ReadFrom(partReader); err != nil {
+			return rawBuffer.Bytes(), err
+		}
+		raw = append([]byte{}, rawBuffer.Bytes()...)
+		// the part was already checked, do not report its warnings again
+		decoded := decodeLeaf(partReader, func(io.Reader) io.Reader {
+			return decodePart(bytes.NewReader(raw), header, nil)
+		})
+		if _, err = w.ReadFrom(decoded); err != nil {
+			w.Truncate(start)
+		}
+		return raw, err
+	}
+	// decoder can stop before the end of part (e.g. base64 padding)
+	if _, errRead := rawBuffer.ReadFrom(partReader); err == nil {
+		err = errRead
+	}
+	return rawBuffer.Bytes(), err
+}
+
 // assume 'text/plain' if missing
 func getContentType(header textproto.MIMEHeader) (mediatype string, params map[string]string, err error) {
 	contentType := header.Get("Content-Type")
@@ -287,7 +629,7 @@ func getContentType(header textproto.MIMEHeader) (mediatype string, params map[s
 		contentType = "text/plain"
 	}
 
-	return mime.ParseMediaType(contentType)
+	return ParseMediaType(contentType)
 }
 
 // ===================== MIME Printer ===================================
@@ -306,6 +648,8 @@ func (s stack) Peek() string {
 	return s[len(s)-1]
 }
 
+// MIMEPrinter prints visited parts in simplified form which does not keep
+// the original bytes. Use Part.WriteTo for byte-exact output.
 type MIMEPrinter struct {
 	result        *bytes.Buffer
 	boundaryStack stack
@@ -342,6 +686,18 @@ func (pd *MIMEPrinter) Accept(partReader io.Reader, header textproto.MIMEHeader,
 	return nil
 }
 
+// EnterMessage prints header of part which contains embedded message. The
+// message itself is printed as a visited part.
+func (pd *MIMEPrinter) EnterMessage(partHeader, messageHeader textproto.MIMEHeader, depth int) (err error) {
+	http.Header(partHeader).Write(pd.result)
+	pd.result.Write([]byte("\n"))
+	return nil
+}
+
+func (pd *MIMEPrinter) LeaveMessage(depth int) (err error) {
+	return nil
+}
+
 func (pd *MIMEPrinter) String() string {
 	return pd.result.String()
 }
@@ -354,6 +710,7 @@ func (pd *MIMEPrinter) String() string {
 type PlainTextCollector struct {
 	target            VisitAcceptor
 	plainTextContents *bytes.Buffer
+	diagnostics       *Diagnostics
 }
 
 func NewPlainTextCollector(targetAccepter VisitAcceptor) *PlainTextCollector {
@@ -366,19 +723,12 @@ func NewPlainTextCollector(targetAccepter VisitAcceptor) *PlainTextCollector {
 func (ptc *PlainTextCollector) Accept(partReader io.Reader, header textproto.MIMEHeader, hasPlainSibling bool, isFirst, isLast bool) (err error) {
 	if isFirst {
 		if IsLeaf(header) {
-			mediaType, params, _ := getContentType(header)
-			disp, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+			mediaType, _, _ := getContentType(header)
+			disp, _, _ := ParseMediaType(header.Get("Content-Disposition"))
 			if mediaType == "text/plain" && disp != "attachment" {
-				partData, _ := ioutil.ReadAll(partReader)
-				decodedPart := decodePart(bytes.NewReader(partData), header)
-
-				if buffer, err := ioutil.ReadAll(decodedPart); err == nil {
-					buffer, err = DecodeCharset(buffer, mediaType, params)
-					if err != nil {
-						log.Println("Decode charset error:", err)
-						err = nil // Don't fail parsing on decoding errors, use original
-					}
-					ptc.plainTextContents.Write(buffer)
+				partData, errRead := readTextPart(partReader, header, ptc.plainTextContents, ptc.diagnostics)
+				if isLimitError(errRead) {
+					return errRead
 				}
 
 				err = ptc.target.Accept(bytes.NewReader(partData), header, hasPlainSibling, isFirst, isLast)
@@ -390,6 +740,26 @@ func (ptc *PlainTextCollector) Accept(partReader io.Reader, header textproto.MIM
 	return
 }
 
+// SetDiagnostics sets where decoding warnings are reported
+func (ptc *PlainTextCollector) SetDiagnostics(d *Diagnostics) {
+	ptc.diagnostics = d
+}
+
+// EnterMessage passes embedded message to target acceptor
+func (ptc *PlainTextCollector) EnterMessage(partHeader, messageHeader textproto.MIMEHeader, depth int) (err error) {
+	return enterMessage(ptc.target, partHeader, messageHeader, depth)
+}
+
+// LeaveMessage passes end of embedded message to target acceptor
+func (ptc *PlainTextCollector) LeaveMessage(depth int) (err error) {
+	return leaveMessage(ptc.target, depth)
+}
+
+// SetSection passes section of visited part to target acceptor
+func (ptc *PlainTextCollector) SetSection(section string) {
+	setSection(ptc.target, section)
+}
+
 func (ptc PlainTextCollector) GetPlainText() string {
 	return ptc.plainTextContents.String()
 }
@@ -406,6 +776,7 @@ type BodyCollector struct {
 	htmlHeaderBuffer  *bytes.Buffer
 	plainHeaderBuffer *bytes.Buffer
 	hasHtml           bool
+	diagnostics       *Diagnostics
 }
 
 func NewBodyCollector(targetAccepter VisitAcceptor) *BodyCollector {
@@ -423,25 +794,29 @@ func (bc *BodyCollector) Accept(partReader io.Reader, header textproto.MIMEHeade
 	if isFirst {
 		if IsLeaf(header) {
 			mediaType, params, _ := getContentType(header)
-			disp, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+			disp, _, _ := ParseMediaType(header.Get("Content-Disposition"))
 			if disp != "attachment" {
-				partData, _ := ioutil.ReadAll(partReader)
-				decodedPart := decodePart(bytes.NewReader(partData), header)
-				if buffer, err := ioutil.ReadAll(decodedPart); err == nil {
-					buffer, err = DecodeCharset(buffer, mediaType, params)
-					if err != nil {
-						log.Println("Decode charset error:", err)
-						err = nil // Don't fail parsing on decoding errors, use original
-					}
-					if mediaType == "text/html" {
+				var partData []byte
+				var errRead error
+				switch mediaType {
+				case "text/html":
+					if partData, errRead = readTextPart(partReader, header, bc.htmlBodyBuffer, bc.diagnostics); errRead == nil {
 						bc.hasHtml = true
 						http.Header(header).Write(bc.htmlHeaderBuffer)
-						bc.htmlBodyBuffer.Write(buffer)
-					} else if mediaType == "text/plain" {
+					}
+				case "text/plain":
+					if partData, errRead = readTextPart(partReader, header, bc.plainBodyBuffer, bc.diagnostics); errRead == nil {
 						http.Header(header).Write(bc.plainHeaderBuffer)
-						bc.plainBodyBuffer.Write(buffer)
+					}
+				default:
+					var buffer []byte
+					if partData, buffer, errRead = readPart(partReader, header, bc.diagnostics); errRead == nil {
+						bc.diagnostics.decodeCharset(buffer, mediaType, params)
 					}
 				}
+				if isLimitError(errRead) {
+					return errRead
+				}
 
 				err = bc.target.Accept(bytes.NewReader(partData), header, hasPlainSibling, isFirst, isLast)
 				return
@@ -452,6 +827,26 @@ func (bc *BodyCollector) Accept(partReader io.Reader, header textproto.MIMEHeade
 	return
 }
 
+// SetDiagnostics sets where decoding warnings are reported
+func (bc *BodyCollector) SetDiagnostics(d *Diagnostics) {
+	bc.diagnostics = d
+}
+
+// EnterMessage passes embedded message to target acceptor
+func (bc *BodyCollector) EnterMessage(partHeader, messageHeader textproto.MIMEHeader, depth int) (err error) {
+	return enterMessage(bc.target, partHeader, messageHeader, depth)
+}
+
+// LeaveMessage passes end of embedded message to target acceptor
+func (bc *BodyCollector) LeaveMessage(depth int) (err error) {
+	return leaveMessage(bc.target, depth)
+}
+
+// SetSection passes section of visited part to target acceptor
+func (bc *BodyCollector) SetSection(section string) {
+	setSection(bc.target, section)
+}
+
 func (bc *BodyCollector) GetBody() (string, string) {
 	if bc.hasHtml {
 		return bc.htmlBodyBuffer.String(), "text/html"
@@ -474,16 +869,15 @@ func (bc *BodyCollector) GetHeaders() string {
 // TODO to file collector_attachment.go
 
 type AttachmentsCollector struct {
-	target     VisitAcceptor
-	attBuffers []string
-	attHeaders []string
+	target      VisitAcceptor
+	attachments []*Attachment
+	diagnostics *Diagnostics
 }
 
 func NewAttachmentsCollector(targetAccepter VisitAcceptor) *AttachmentsCollector {
 	return &AttachmentsCollector{
-		target:     targetAccepter,
-		attBuffers: []string{},
-		attHeaders: []string{},
+		target:      targetAccepter,
+		attachments: []*Attachment{},
 	}
 }
 
@@ -491,21 +885,19 @@ func (ac *AttachmentsCollector) Accept(partReader io.Reader, header textproto.MI
 	if isFirst {
 		if IsLeaf(header) {
 			mediaType, params, _ := getContentType(header)
-			disp, _, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+			disp, _, _ := ParseMediaType(header.Get("Content-Disposition"))
 			if (mediaType != "text/html" && mediaType != "text/plain") || disp == "attachment" {
-				partData, _ := ioutil.ReadAll(partReader)
-				decodedPart := decodePart(bytes.NewReader(partData), header)
-
-				if buffer, err := ioutil.ReadAll(decodedPart); err == nil {
-					buffer, err = DecodeCharset(buffer, mediaType, params)
-					if err != nil {
-						log.Println("Decode charset error:", err)
-						err = nil // Don't fail parsing on decoding errors, use original
+				partData, buffer, errRead := readPart(partReader, header, ac.diagnostics)
+				if isLimitError(errRead) {
+					return errRead
+				}
+				if errRead == nil {
+					attachment := NewAttachment(header, buffer)
+					// Binary data must stay untouched even with charset parameter
+					if strings.HasPrefix(mediaType, "text/") {
+						attachment.text = ac.diagnostics.decodeCharset(buffer, mediaType, params)
 					}
-					headerBuf := new(bytes.Buffer)
-					http.Header(header).Write(headerBuf)
-					ac.attHeaders = append(ac.attHeaders, headerBuf.String())
-					ac.attBuffers = append(ac.attBuffers, string(buffer))
+					ac.attachments = append(ac.attachments, attachment)
 				}
 
 				err = ac.target.Accept(bytes.NewReader(partData), header, hasPlainSibling, isFirst, isLast)
@@ -517,10 +909,53 @@ func (ac *AttachmentsCollector) Accept(partReader io.Reader, header textproto.MI
 	return
 }
 
+// SetDiagnostics sets where decoding warnings are reported
+func (ac *AttachmentsCollector) SetDiagnostics(d *Diagnostics) {
+	ac.diagnostics = d
+}
+
+// EnterMessage passes embedded message to target acceptor
+func (ac *AttachmentsCollector) EnterMessage(partHeader, messageHeader textproto.MIMEHeader, depth int) (err error) {
+	return enterMessage(ac.target, partHeader, messageHeader, depth)
+}
+
+// LeaveMessage passes end of embedded message to target acceptor
+func (ac *AttachmentsCollector) LeaveMessage(depth int) (err error) {
+	return leaveMessage(ac.target, depth)
+}
+
+// SetSection passes section of visited part to target acceptor
+func (ac *AttachmentsCollector) SetSection(section string) {
+	setSection(ac.target, section)
+}
+
+// GetAttachments returns content of attachments. Text attachments are
+// converted to utf8.
 func (ac AttachmentsCollector) GetAttachments() []string {
-	return ac.attBuffers
+	attBuffers := make([]string, len(ac.attachments))
+	for i, attachment := range ac.attachments {
+		if attachment.text != nil {
+			attBuffers[i] = string(attachment.text)
+		} else {
+			attBuffers[i] = string(attachment.Data)
+		}
+	}
+	return attBuffers
 }
 
+// GetAttHeaders returns headers of attachments in wire format
 func (ac AttachmentsCollector) GetAttHeaders() []string {
-	return ac.attHeaders
+	attHeaders := make([]string, len(ac.attachments))
+	for i, attachment := range ac.attachments {
+		headerBuf := new(bytes.Buffer)
+		http.Header(attachment.Header).Write(headerBuf)
+		attHeaders[i] = headerBuf.String()
+	}
+	return attHeaders
+}
+
+// GetAttachmentList returns collected attachments with their decoded,
+// otherwise untouched data.
+func (ac AttachmentsCollector) GetAttachmentList() []*Attachment {
+	return ac.attachments
 }
@@ -2,6 +2,8 @@ package gomime
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 
 	"io/ioutil"
 	"net/mail"
@@ -326,3 +328,159 @@ TqRoIApQlGggySjCNBAJQcgggEAIFqCCASAklqCCALT1TfhDdEgggNI9v1SXM/ugggjDmHqEEEEy
 		t.Error("parse error", err)
 	}
 }
+
+func collectWithVisitor(mimeBody string, newVisitor func(VisitAcceptor) *MimeVisitor) (plain, body string, atts []string, err error) {
+	mm, err := mail.ReadMessage(strings.NewReader(mimeBody))
+	if err != nil {
+		return
+	}
+
+	printAccepter := NewMIMEPrinter()
+	plainTextCollector := NewPlainTextCollector(printAccepter)
+	bodyCollector := NewBodyCollector(plainTextCollector)
+	attachmentsCollector := NewAttachmentsCollector(bodyCollector)
+	err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), newVisitor(attachmentsCollector))
+
+	plain = plainTextCollector.GetPlainText()
+	body, _ = bodyCollector.GetBody()
+	atts = attachmentsCollector.GetAttachments()
+	return
+}
+
+func TestStreamingVisitor(t *testing.T) {
+	testMessage :=
+		`From: John Doe <example@example.com>
+MIME-Version: 1.0
+Content-Type: multipart/mixed; boundary="outer"
+
+--outer
+Content-Type: multipart/alternative; boundary="inner"
+
+--inner
+Content-Type: text/plain; charset=koi8-r
+Content-Transfer-Encoding: quoted-printable
+
+=C1=DA=C2=D5=CB=C1
+--inner
+Content-Type: text/html; charset=utf-8
+
+<html><body>azbuka</body></html>
+--inner--
+
+--outer
+Content-Type: application/octet-stream
+Content-Transfer-Encoding: base64
+Content-Disposition: attachment; filename="data.bin"
+
+AAECAwQF
+--outer--
+`
+
+	wantPlain, wantBody, wantAtts, err := collectWithVisitor(testMessage, NewMimeVisitor)
+	if err != nil {
+		t.Fatal("buffered visitor error", err)
+	}
+	plain, body, atts, err := collectWithVisitor(testMessage, NewStreamingMimeVisitor)
+	if err != nil {
+		t.Fatal("streaming visitor error", err)
+	}
+
+	if plain != "азбука" || plain != wantPlain {
+		t.Errorf("unexpected plain text %q, buffered visitor has %q", plain, wantPlain)
+	}
+	if body != wantBody {
+		t.Errorf("unexpected body %q, buffered visitor has %q", body, wantBody)
+	}
+	if len(atts) != 1 || len(wantAtts) != 1 || atts[0] != wantAtts[0] || atts[0] != "\x00\x01\x02\x03\x04\x05" {
+		t.Errorf("unexpected attachments %q, buffered visitor has %q", atts, wantAtts)
+	}
+}
+
+type messageRecorder struct {
+	events []string
+}
+
+func (mr *messageRecorder) Accept(partReader io.Reader, header textproto.MIMEHeader, hasPlainSibling bool, isFirst, isLast bool) (err error) {
+	if isFirst && IsLeaf(header) {
+		mediaType, _, _ := getContentType(header)
+		mr.events = append(mr.events, mediaType)
+	}
+	return
+}
+
+func (mr *messageRecorder) EnterMessage(partHeader, messageHeader textproto.MIMEHeader, depth int) (err error) {
+	mr.events = append(mr.events, fmt.Sprintf("enter %d %s", depth, messageHeader.Get("Subject")))
+	return
+}
+
+func (mr *messageRecorder) LeaveMessage(depth int) (err error) {
+	mr.events = append(mr.events, fmt.Sprintf("leave %d", depth))
+	return
+}
+
+func TestVisitorDescendMessages(t *testing.T) {
+	for _, newVisitor := range []func(VisitAcceptor) *MimeVisitor{NewMimeVisitor, NewStreamingMimeVisitor} {
+		mm, err := mail.ReadMessage(strings.NewReader(forwardedTestMessage))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := &messageRecorder{}
+		plainTextCollector := NewPlainTextCollector(recorder)
+		visitor := newVisitor(plainTextCollector)
+		visitor.SetDescendMessages(true)
+		if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+			t.Fatal("visit error", err)
+		}
+
+		expected := "text/plain,enter 1 report,text/plain,enter 2 data,text/plain,leave 2,leave 1"
+		if events := strings.Join(recorder.events, ","); events != expected {
+			t.Errorf("unexpected events %q", events)
+		}
+		if plain := plainTextCollector.GetPlainText(); plain != "see attachedthe reportoriginal data" {
+			t.Errorf("unexpected plain text %q", plain)
+		}
+	}
+}
+
+func TestVisitorBadEmbeddedMessage(t *testing.T) {
+	message := "Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"see attached\r\n" +
+		"--b\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"not a header\r\n" +
+		"\r\n" +
+		"body\r\n" +
+		"--b--\r\n"
+	for _, newVisitor := range []func(VisitAcceptor) *MimeVisitor{NewMimeVisitor, NewStreamingMimeVisitor} {
+		mm, err := mail.ReadMessage(strings.NewReader(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		diagnostics := NewDiagnostics()
+		recorder := &messageRecorder{}
+		attachmentsCollector := NewAttachmentsCollector(recorder)
+		visitor := newVisitor(attachmentsCollector)
+		visitor.SetDescendMessages(true)
+		visitor.SetDiagnostics(diagnostics)
+		if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+			t.Fatal("visit error", err)
+		}
+
+		if events := strings.Join(recorder.events, ","); events != "text/plain,message/rfc822" {
+			t.Errorf("unexpected events %q", events)
+		}
+		if len(diagnostics.Warnings) != 1 || diagnostics.Warnings[0].Code != WarningBadEmbeddedMessage || diagnostics.Warnings[0].Section != "2" {
+			t.Errorf("unexpected warnings %v", diagnostics.Warnings)
+		}
+		if atts := attachmentsCollector.GetAttachments(); len(atts) != 1 || atts[0] != "not a header\r\n\r\nbody" {
+			t.Errorf("unexpected attachments %q", atts)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package gomime
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/textproto"
+	"strings"
+)
+
+// errMissingBoundary is returned by parseContentHeaders for multipart
+// without boundary which is kept as text/plain
+var errMissingBoundary = errors.New("multipart: boundary is empty")
+
+// Part is a node of parsed MIME message tree. The root part holds the
+// top-level header of the message. Part containing embedded message
+// (message/rfc822 or message/global) has the root of the embedded message as
+// its only child.
+type Part struct {
+	Header textproto.MIMEHeader
+
+	MediaType         string
+	MediaTypeParams   map[string]string
+	Disposition       string
+	DispositionParams map[string]string
+	TransferEncoding  string
+
+	Parent   *Part
+	Children []*Part
+
+	// Warnings found while parsing the part
+	Warnings []Warning
+
+	// Offsets of the part in the original message, nil for parts of
+	// embedded message decoded from content transfer encoding
+	Offsets *Offsets
+
+	rawHeader []byte
+	rawBody   []byte
+
+	// multipart body as parsed, delimiters are relative to rawBody
+	boundary   string
+	delimiters []Range
+	closed     bool
+	// modified is set when the part was edited after parsing
+	modified bool
+}
+
+// Parse reads whole message from r and returns the root of its MIME tree.
+func Parse(r io.Reader) (*Part, error) {
+	return ParseWithLimits(r, Limits{})
+}
+
+// ParseWithLimits is like Parse but fails with LimitError when message
+// exceeds limits.
+func ParseWithLimits(r io.Reader, limits Limits) (*Part, error) {
+	l := newLimiter(limits)
+	data, err := ioutil.ReadAll(l.containerReader(r))
+	if err != nil {
+		return nil, err
+	}
+	root, err := parsePart(data, 0, nil, l)
+	if err != nil {
+		return nil, err
+	}
+	// sections are known only when the whole tree is built
+	_ = root.Walk(func(p *Part) error {
+		for i := range p.Warnings {
+			p.Warnings[i].Section = p.Section()
+		}
+		return nil
+	})
+	return root, nil
+}
+
+// parsePart parses data which start at offset of the original message,
+// offset is negative when data are not part of the original message.
+func parsePart(data []byte, offset int64, parent *Part, l *limiter) (p *Part, err error) {
+	p = &Part{Parent: parent}
+	if err = l.checkDepth(p.depth()); err != nil {
+		return
+	}
+	if err = l.addPart(); err != nil {
+		return
+	}
+	p.rawHeader, p.rawBody = splitHeaderBody(data)
+	if offset >= 0 {
+		headerEnd := offset + int64(len(p.rawHeader))
+		p.Offsets = &Offsets{
+			Header: Range{offset, headerEnd},
+			Body:   Range{headerEnd, offset + int64(len(data))},
+		}
+	}
+	if err = l.checkRawHeader(p.rawHeader); err != nil {
+		return
+	}
+
+	p.Header, err = textproto.NewReader(bufio.NewReader(bytes.NewReader(p.rawHeader))).ReadMIMEHeader()
+	if err == io.EOF {
+		err = nil // header without body
+	}
+	if err != nil {
+		return
+	}
+
+	if err = p.parseContentHeaders(); err == errMissingBoundary {
+		p.warn(WarningMissingBoundary, err)
+		err = nil
+	}
+	if err != nil {
+		return
+	}
+	if strings.HasPrefix(p.MediaType, "multipart/") {
+		boundary := p.MediaTypeParams["boundary"]
+		children, delimiters, closed := splitMultipart(p.rawBody, boundary)
+		p.boundary, p.delimiters, p.closed = boundary, delimiters, closed
+		if !closed {
+			p.warn(WarningMissingBoundaryTerminator, nil)
+		}
+		if p.Offsets != nil {
+			for _, delimiter := range delimiters {
+				p.Offsets.Boundaries = append(p.Offsets.Boundaries, delimiter.shift(p.Offsets.Body.Start))
+			}
+		}
+		for _, childRange := range children {
+			childOffset := int64(-1)
+			if p.Offsets != nil {
+				childOffset = p.Offsets.Body.Start + childRange.Start
+			}
+			var child *Part
+			if child, err = parsePart(p.rawBody[childRange.Start:childRange.End], childOffset, p, l); err != nil {
+				return
+			}
+			p.Children = append(p.Children, child)
+		}
+	} else if isEmbeddedMessage(p.MediaType) {
+		err = p.parseEmbeddedMessage(l)
+	}
+	switch {
+	case err != nil:
+	case p.IsLeaf():
+		err = p.checkContent(l)
+	case DecodeContentEncoding(bytes.NewReader(nil), p.TransferEncoding) == nil:
+		p.warn(WarningUnknownTransferEncoding, fmt.Errorf("unsupported Content-Transfer-Encoding '%v'", p.TransferEncoding))
+	}
+	return
+}
+
+// checkContent decodes content of leaf to report malformed transfer
+// encoding or charset and to check size of decoded content
+func (p *Part) checkContent(l *limiter) error {
+	d := NewDiagnostics()
+	content := &errorReader{r: l.partReader(decodePart(p.Body(), p.Header, d))}
+	var decoded io.Reader = content
+	if strings.HasPrefix(p.MediaType, "text/") {
+		decoded = d.decodeCharsetReader(content, p.MediaType, p.MediaTypeParams)
+	}
+	_, err := io.Copy(ioutil.Discard, decoded)
+	switch {
+	case isLimitError(content.err):
+		return content.err
+	case content.err != nil:
+		d.warnTransferEncoding(p.TransferEncoding, content.err)
+	case err != nil:
+		d.warnCharset(p.MediaTypeParams, err)
+	}
+	p.Warnings = append(p.Warnings, d.Warnings...)
+	return nil
+}
+
+// parseContentHeaders sets content fields from Header
+func (p *Part) parseContentHeaders() (err error) {
+	if p.MediaType, p.MediaTypeParams, err = getContentType(p.Header); err != nil {
+		return
+	}
+	p.Disposition, p.DispositionParams, _ = ParseMediaType(p.Header.Get("Content-Disposition"))
+	p.TransferEncoding = NormalizeTransferEncoding(p.Header.Get("Content-Transfer-Encoding"))
+	if strings.HasPrefix(p.MediaType, "multipart/") && p.MediaTypeParams["boundary"] == "" {
+		// multipart can not be split, RFC 2045 default for invalid
+		// Content-Type is used
+		p.MediaType, p.MediaTypeParams = "text/plain", map[string]string{"charset": "us-ascii"}
+		err = errMissingBoundary
+	}
+	return
+}
+
+// depth returns the number of ancestors
+func (p *Part) depth() (depth int) {
+	for parent := p.Parent; parent != nil; parent = parent.Parent {
+		depth++
+	}
+	return
+}
+
+// parseEmbeddedMessage adds embedded message as child. Message which can
+// not be parsed is kept as leaf, only LimitError is returned.
+func (p *Part) parseEmbeddedMessage(l *limiter) error {
+	data, offset := p.rawBody, int64(-1)
+	if p.Offsets != nil {
+		offset = p.Offsets.Body.Start
+	}
+	switch p.TransferEncoding {
+	case "7bit", "8bit", "binary", "":
+	default:
+		offset = -1
+		d := NewDiagnostics()
+		var err error
+		data, err = ioutil.ReadAll(l.containerReader(decodePart(p.Body(), p.Header, d)))
+		p.Warnings = append(p.Warnings, d.Warnings...)
+		if isLimitError(err) {
+			return err
+		}
+		if err != nil {
+			p.warn(WarningBadEmbeddedMessage, err)
+			return nil
+		}
+	}
+	child, err := parsePart(data, offset, p, l)
+	if isLimitError(err) {
+		return err
+	}
+	if err != nil {
+		p.warn(WarningBadEmbeddedMessage, err)
+		return nil
+	}
+	p.Children = []*Part{child}
+	return nil
+}
+
+func (p *Part) warn(code WarningCode, err error) {
+	p.Warnings = append(p.Warnings, Warning{Code: code, Err: err})
+}
+
+// splitHeaderBody returns header including the empty line which terminates
+// it and the rest of data as body.
+func splitHeaderBody(data []byte) (header, body []byte) {
+	for start := 0; start < len(data); {
+		end := bytes.IndexByte(data[start:], '\n')
+		if end < 0 {
+			break
+		}
+		end += start + 1
+		if line := data[start:end]; len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return data[:end], data[end:]
+		}
+		start = end
+	}
+	return data, nil
+}
+
+// splitMultipart returns ranges of the content of each body part and of
+// each delimiter line in body. The line break before delimiter belongs to
+// delimiter. Preamble and epilogue are ignored and a missing close
+// delimiter is tolerated.
+func splitMultipart(body []byte, boundary string) (parts, delimiters []Range, closed bool) {
+	delimiter := []byte("--" + boundary)
+	partStart := -1
+	for start := 0; start < len(body); {
+		end := bytes.IndexByte(body[start:], '\n')
+		if end < 0 {
+			end = len(body)
+		} else {
+			end += start + 1
+		}
+
+		line := body[start:end]
+		if isClose, ok := isDelimiterLine(line, delimiter); ok {
+			delimiterStart := trimLineBreak(body, 0, start)
+			if partStart >= 0 {
+				delimiterStart = trimLineBreak(body, partStart, start)
+				parts = append(parts, Range{int64(partStart), int64(delimiterStart)})
+			}
+			delimiters = append(delimiters, Range{int64(delimiterStart), int64(end)})
+			if isClose {
+				return parts, delimiters, true
+			}
+			partStart = end
+		}
+		start = end
+	}
+	if partStart >= 0 {
+		parts = append(parts, Range{int64(partStart), int64(len(body))})
+	}
+	return parts, delimiters, false
+}
+
+// isDelimiterLine checks whether line is boundary delimiter optionally
+// followed by "--" (close delimiter) and transport padding.
+func isDelimiterLine(line, delimiter []byte) (isClose, ok bool) {
+	if !bytes.HasPrefix(line, delimiter) {
+		return false, false
+	}
+	rest := line[len(delimiter):]
+	if bytes.HasPrefix(rest, []byte("--")) {
+		isClose = true
+		rest = rest[2:]
+	}
+	return isClose, len(bytes.TrimRight(rest, " \t\r\n")) == 0
+}
+
+// trimLineBreak returns the end of part content which is the position of
+// the line break preceding the delimiter at delimiterStart.
+func trimLineBreak(body []byte, partStart, delimiterStart int) int {
+	end := delimiterStart
+	if end > partStart && body[end-1] == '\n' {
+		end--
+		if end > partStart && body[end-1] == '\r' {
+			end--
+		}
+	}
+	return end
+}
+
+// IsLeaf returns true for parts which are not containers of other parts.
+// Part with parsed embedded message is not a leaf.
+func (p *Part) IsLeaf() bool {
+	return len(p.Children) == 0 && !strings.HasPrefix(p.MediaType, "multipart/")
+}
+
+// Body returns reader of raw part body, i.e. without decoding of content
+// transfer encoding.
+func (p *Part) Body() io.Reader {
+	return bytes.NewReader(p.rawBody)
+}
+
+// DecodedBody returns reader of part body with content transfer encoding
+// decoded. The charset is not converted. Malformed content is reported in
+// Warnings by Parse.
+func (p *Part) DecodedBody() io.Reader {
+	return decodePart(p.Body(), p.Header, nil)
+}
+
+// Section returns IMAP section path of the part, e.g. "2.1". The top-level
+// multipart of message has empty section and the body of message which is
+// not multipart has section "1". Multipart which is the top-level part of
+// embedded message has the same section as the enclosing message part.
+func (p *Part) Section() string {
+	return formatSection(p.sectionPath())
+}
+
+func (p *Part) sectionPath() (section []int) {
+	if p.Parent == nil || isEmbeddedMessage(p.Parent.MediaType) {
+		if p.Parent != nil {
+			section = p.Parent.sectionPath()
+		}
+		if !strings.HasPrefix(p.MediaType, "multipart/") {
+			section = appendSection(section, 1)
+		}
+		return
+	}
+	for i, sibling := range p.Parent.Children {
+		if sibling == p {
+			return appendSection(p.Parent.sectionPath(), i+1)
+		}
+	}
+	return
+}
+
+// Walk calls fn for the part and all its descendants in depth-first order.
+// It stops at first error returned by fn.
+func (p *Part) Walk(fn func(*Part) error) error {
+	if err := fn(p); err != nil {
+		return err
+	}
+	for _, child := range p.Children {
+		if err := child.Walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package gomime
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const partTestMessage = "From: John Doe <example@example.com>\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"This is a multipart message in MIME format.\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=utf-8\r\n" +
+	"Content-Transfer-Encoding: quoted-printable\r\n" +
+	"\r\n" +
+	"caf=C3=A9\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=utf-8\r\n" +
+	"\r\n" +
+	"<p>caf\xc3\xa9</p>\r\n" +
+	"--inner--\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"Content-Disposition: attachment; filename=\"data.bin\"\r\n" +
+	"\r\n" +
+	"AAECAwQF\r\n" +
+	"--outer--\r\n"
+
+func TestParsePartTree(t *testing.T) {
+	root, err := Parse(strings.NewReader(partTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	if root.MediaType != "multipart/mixed" || root.MediaTypeParams["boundary"] != "outer" || len(root.Children) != 2 {
+		t.Fatalf("unexpected root %v %v with %d children", root.MediaType, root.MediaTypeParams, len(root.Children))
+	}
+	if root.Header.Get("From") != "John Doe <example@example.com>" {
+		t.Error("unexpected root header", root.Header)
+	}
+
+	alternative := root.Children[0]
+	if alternative.MediaType != "multipart/alternative" || alternative.Parent != root || len(alternative.Children) != 2 {
+		t.Fatalf("unexpected alternative %v with %d children", alternative.MediaType, len(alternative.Children))
+	}
+
+	plain := alternative.Children[0]
+	if !plain.IsLeaf() || plain.MediaType != "text/plain" || plain.TransferEncoding != "quoted-printable" {
+		t.Errorf("unexpected plain part %v %v", plain.MediaType, plain.TransferEncoding)
+	}
+	if raw, _ := ioutil.ReadAll(plain.Body()); string(raw) != "caf=C3=A9" {
+		t.Errorf("unexpected raw body %q", raw)
+	}
+	if decoded, _ := ioutil.ReadAll(plain.DecodedBody()); string(decoded) != "café" {
+		t.Errorf("unexpected decoded body %q", decoded)
+	}
+
+	attachment := root.Children[1]
+	if attachment.Disposition != "attachment" || attachment.DispositionParams["filename"] != "data.bin" {
+		t.Errorf("unexpected disposition %v %v", attachment.Disposition, attachment.DispositionParams)
+	}
+	if decoded, _ := ioutil.ReadAll(attachment.DecodedBody()); string(decoded) != "\x00\x01\x02\x03\x04\x05" {
+		t.Errorf("unexpected decoded attachment %q", decoded)
+	}
+
+	var mediaTypes []string
+	_ = root.Walk(func(p *Part) error {
+		mediaTypes = append(mediaTypes, p.MediaType)
+		return nil
+	})
+	if strings.Join(mediaTypes, ",") != "multipart/mixed,multipart/alternative,text/plain,text/html,application/octet-stream" {
+		t.Error("unexpected walk order", mediaTypes)
+	}
+}
+
+func TestParseMissingCloseDelimiter(t *testing.T) {
+	root, err := Parse(strings.NewReader("Content-Type: multipart/mixed; boundary=b\n\n--b\nContent-Type: text/plain\n\nfirst\n--b\n\nsecond\n"))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if len(root.Children) != 2 {
+		t.Fatal("expected two children but have", len(root.Children))
+	}
+	if body, _ := ioutil.ReadAll(root.Children[1].Body()); string(body) != "second\n" {
+		t.Errorf("unexpected body of last part %q", body)
+	}
+}
+
+func TestParseBoundaryMissing(t *testing.T) {
+	root, err := Parse(strings.NewReader("Content-Type: multipart/mixed; boundary=b\n" +
+		"\n" +
+		"--b\n" +
+		"Content-Type: multipart/alternative\n" +
+		"\n" +
+		"body\n" +
+		"--b--\n"))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if len(root.Children) != 1 {
+		t.Fatal("expected one child but have", len(root.Children))
+	}
+	part := root.Children[0]
+	if !part.IsLeaf() || part.MediaType != "text/plain" {
+		t.Errorf("expected text/plain leaf but have %v", part.MediaType)
+	}
+	if len(part.Warnings) != 1 || part.Warnings[0].Code != WarningMissingBoundary {
+		t.Errorf("unexpected warnings %v", part.Warnings)
+	}
+	if body, _ := ioutil.ReadAll(part.DecodedBody()); string(body) != "body" {
+		t.Errorf("unexpected body %q", body)
+	}
+}
+
+const forwardedTestMessage = "From: Alice <alice@example.com>\r\n" +
+	"Subject: Fwd: report\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"see attached\r\n" +
+	"--outer\r\n" +
+	"Content-Type: message/rfc822\r\n" +
+	"Content-Disposition: attachment\r\n" +
+	"\r\n" +
+	"From: Bob <bob@example.com>\r\n" +
+	"Subject: report\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"fwd\"\r\n" +
+	"\r\n" +
+	"--fwd\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"\r\n" +
+	"the report\r\n" +
+	"--fwd\r\n" +
+	"Content-Type: message/global\r\n" +
+	"\r\n" +
+	"From: Carol <carol@example.com>\r\n" +
+	"Subject: data\r\n" +
+	"\r\n" +
+	"original data\r\n" +
+	"--fwd--\r\n" +
+	"--outer--\r\n"
+
+func TestParseEmbeddedMessage(t *testing.T) {
+	root, err := Parse(strings.NewReader(forwardedTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	rfc822 := root.Children[1]
+	if rfc822.IsLeaf() || len(rfc822.Children) != 1 {
+		t.Fatalf("expected embedded message as child of %v", rfc822.MediaType)
+	}
+	embedded := rfc822.Children[0]
+	if embedded.Parent != rfc822 || embedded.Header.Get("Subject") != "report" || len(embedded.Children) != 2 {
+		t.Fatalf("unexpected embedded message %v %v", embedded.Header, embedded.MediaType)
+	}
+	global := embedded.Children[1]
+	if len(global.Children) != 1 || global.Children[0].Header.Get("Subject") != "data" {
+		t.Fatal("expected message/global to be parsed")
+	}
+	if body, _ := ioutil.ReadAll(global.Children[0].Body()); string(body) != "original data" {
+		t.Errorf("unexpected body of embedded message %q", body)
+	}
+}
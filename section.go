@@ -0,0 +1,159 @@
+package gomime
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// ErrSectionNotFound is returned when message has no part with requested
+// section
+var ErrSectionNotFound = errors.New("gomime: section not found")
+
+// FetchSection reads message from r and returns raw content of IMAP body
+// section as for BODY[section] fetch, e.g. "" for whole message, "2.1",
+// "2.1.MIME", "2.HEADER", "TEXT". HEADER.FIELDS sections are not supported.
+func FetchSection(r io.Reader, section string) ([]byte, error) {
+	root, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return root.FetchSection(section)
+}
+
+// FetchDecodedSection is like FetchSection but content transfer encoding of
+// section which is the body of non-multipart part is decoded.
+func FetchDecodedSection(r io.Reader, section string) ([]byte, error) {
+	root, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	return root.FetchDecodedSection(section)
+}
+
+// FindSection returns part with IMAP section path (e.g. "2.1") in the tree
+// of message with root p. Part containing embedded message is returned
+// instead of the top-level multipart of the message having the same section.
+func (p *Part) FindSection(section string) (*Part, error) {
+	path, err := parseSectionPath(section)
+	if err != nil {
+		return nil, err
+	}
+	// top is the top-level part of message or the part itself, parts
+	// numbered under the part are its children when top is multipart and
+	// the body of message otherwise
+	var found *Part
+	top := p
+	for _, index := range path {
+		var numbered []*Part
+		switch {
+		case top == nil:
+		case strings.HasPrefix(top.MediaType, "multipart/"):
+			numbered = top.Children
+		case top != found:
+			numbered = []*Part{top}
+		}
+		if index > len(numbered) {
+			return nil, ErrSectionNotFound
+		}
+		found, top = numbered[index-1], numbered[index-1]
+		if isEmbeddedMessage(found.MediaType) {
+			top = nil
+			if len(found.Children) == 1 {
+				top = found.Children[0]
+			}
+		}
+	}
+	return found, nil
+}
+
+// FetchSection returns raw content of IMAP body section of message with
+// root p, see FetchSection.
+func (p *Part) FetchSection(section string) ([]byte, error) {
+	part, specifier, err := p.resolveSection(section)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case section == "":
+		return append(append([]byte{}, p.rawHeader...), p.rawBody...), nil
+	case specifier == "MIME" || specifier == "HEADER":
+		return part.rawHeader, nil
+	default:
+		return part.rawBody, nil
+	}
+}
+
+// FetchDecodedSection returns IMAP body section of message with root p
+// with content transfer encoding decoded, see FetchDecodedSection.
+func (p *Part) FetchDecodedSection(section string) ([]byte, error) {
+	part, specifier, err := p.resolveSection(section)
+	if err != nil {
+		return nil, err
+	}
+	if (specifier == "" && section != "") || specifier == "TEXT" {
+		if !strings.HasPrefix(part.MediaType, "multipart/") {
+			return ioutil.ReadAll(part.DecodedBody())
+		}
+	}
+	return p.FetchSection(section)
+}
+
+// resolveSection returns the part which holds requested section. For
+// HEADER and TEXT specifiers it is the root of the (embedded) message.
+func (p *Part) resolveSection(section string) (part *Part, specifier string, err error) {
+	path, specifier := splitSectionSpecifier(section)
+	switch specifier {
+	case "", "MIME", "HEADER", "TEXT":
+	default:
+		return nil, "", fmt.Errorf("gomime: unsupported section %q", section)
+	}
+
+	if path == "" {
+		if specifier == "MIME" {
+			return nil, "", fmt.Errorf("gomime: invalid section %q", section)
+		}
+		return p, specifier, nil
+	}
+	if part, err = p.FindSection(path); err != nil {
+		return
+	}
+	if specifier == "HEADER" || specifier == "TEXT" {
+		if !isEmbeddedMessage(part.MediaType) {
+			return nil, "", fmt.Errorf("gomime: section %q is not message", path)
+		}
+		if len(part.Children) != 1 {
+			return nil, "", ErrSectionNotFound
+		}
+		part = part.Children[0]
+	}
+	return
+}
+
+// splitSectionSpecifier splits section to part path and upper case
+// specifier
+func splitSectionSpecifier(section string) (path, specifier string) {
+	parts := strings.Split(section, ".")
+	i := 0
+	for ; i < len(parts); i++ {
+		if _, err := strconv.Atoi(parts[i]); err != nil {
+			break
+		}
+	}
+	return strings.Join(parts[:i], "."), strings.ToUpper(strings.Join(parts[i:], "."))
+}
+
+// parseSectionPath parses part path like "2.1"
+func parseSectionPath(section string) (path []int, err error) {
+	for _, number := range strings.Split(section, ".") {
+		index, errAtoi := strconv.Atoi(number)
+		if errAtoi != nil || index < 1 {
+			return nil, fmt.Errorf("gomime: invalid section %q", section)
+		}
+		path = append(path, index)
+	}
+	return
+}
@@ -0,0 +1,132 @@
+package gomime
+
+import (
+	"io"
+	"net/mail"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+type sectionRecorder struct {
+	section string
+	events  []string
+}
+
+func (sr *sectionRecorder) SetSection(section string) {
+	sr.section = section
+}
+
+func (sr *sectionRecorder) Accept(partReader io.Reader, header textproto.MIMEHeader, hasPlainSibling bool, isFirst, isLast bool) (err error) {
+	if isFirst {
+		mediaType, _, _ := getContentType(header)
+		sr.events = append(sr.events, sr.section+":"+mediaType)
+	}
+	return
+}
+
+func TestVisitorSections(t *testing.T) {
+	for _, newVisitor := range []func(VisitAcceptor) *MimeVisitor{NewMimeVisitor, NewStreamingMimeVisitor} {
+		mm, err := mail.ReadMessage(strings.NewReader(forwardedTestMessage))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		recorder := &sectionRecorder{}
+		visitor := newVisitor(NewBodyCollector(recorder))
+		visitor.SetDescendMessages(true)
+		if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+			t.Fatal("visit error", err)
+		}
+
+		expected := ":multipart/mixed,1:text/plain,2:multipart/mixed,2.1:text/plain,2.2.1:text/plain"
+		if events := strings.Join(recorder.events, ","); events != expected {
+			t.Errorf("unexpected sections %q", events)
+		}
+	}
+}
+
+func TestFetchSection(t *testing.T) {
+	testData := []struct {
+		section, raw, decoded string
+	}{
+		{"1.1", "caf=C3=A9", "caf\xc3\xa9"},
+		{"1.1.MIME", "Content-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n", ""},
+		{"2", "AAECAwQF", "\x00\x01\x02\x03\x04\x05"},
+		{"HEADER", "From: John Doe <example@example.com>\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=\"outer\"\r\n\r\n", ""},
+		{"", partTestMessage, ""},
+	}
+
+	for _, val := range testData {
+		raw, err := FetchSection(strings.NewReader(partTestMessage), val.section)
+		if err != nil || string(raw) != val.raw {
+			t.Errorf("unexpected section %q: %q %v", val.section, raw, err)
+		}
+		if val.decoded == "" {
+			val.decoded = val.raw
+		}
+		decoded, err := FetchDecodedSection(strings.NewReader(partTestMessage), val.section)
+		if err != nil || string(decoded) != val.decoded {
+			t.Errorf("unexpected decoded section %q: %q %v", val.section, decoded, err)
+		}
+	}
+
+	if text, _ := FetchSection(strings.NewReader(partTestMessage), "TEXT"); !strings.HasPrefix(string(text), "This is a multipart message") {
+		t.Errorf("unexpected text %q", text)
+	}
+	for _, section := range []string{"3", "1.3", "1.1.1"} {
+		if _, err := FetchSection(strings.NewReader(partTestMessage), section); err != ErrSectionNotFound {
+			t.Errorf("expected not found %q but have %v", section, err)
+		}
+	}
+	for _, section := range []string{"MIME", "0", "1.HEADER", "HEADER.FIELDS (From)"} {
+		if _, err := FetchSection(strings.NewReader(partTestMessage), section); err == nil || err == ErrSectionNotFound {
+			t.Errorf("expected invalid section %q but have %v", section, err)
+		}
+	}
+}
+
+func TestFetchSectionEmbeddedMessage(t *testing.T) {
+	root, err := Parse(strings.NewReader(forwardedTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	testData := map[string]string{
+		"2.HEADER":   "From: Bob <bob@example.com>\r\nSubject: report\r\nContent-Type: multipart/mixed; boundary=\"fwd\"\r\n\r\n",
+		"2.1":        "the report",
+		"2.2.HEADER": "From: Carol <carol@example.com>\r\nSubject: data\r\n\r\n",
+		"2.2.TEXT":   "original data",
+		"2.2.1":      "original data",
+		"2.MIME":     "Content-Type: message/rfc822\r\nContent-Disposition: attachment\r\n\r\n",
+	}
+	for section, expected := range testData {
+		if data, err := root.FetchSection(section); err != nil || string(data) != expected {
+			t.Errorf("unexpected section %q: %q %v", section, data, err)
+		}
+	}
+
+	if part, err := root.FindSection("2"); err != nil || part.MediaType != "message/rfc822" {
+		t.Errorf("expected message part for section 2 but have %v %v", part, err)
+	}
+}
+
+func TestFindSectionOfEachPart(t *testing.T) {
+	for _, message := range []string{partTestMessage, forwardedTestMessage, "Content-Type: text/plain\r\n\r\nbody"} {
+		root, err := Parse(strings.NewReader(message))
+		if err != nil {
+			t.Fatal("parse error", err)
+		}
+		_ = root.Walk(func(part *Part) error {
+			section := part.Section()
+			if section == "" || (part.Parent != nil && isEmbeddedMessage(part.Parent.MediaType) && strings.HasPrefix(part.MediaType, "multipart/")) {
+				// top-level multipart has section of the message
+				return nil
+			}
+			if found, err := root.FindSection(section); err != nil || found != part {
+				t.Errorf("unexpected part for section %q: %v %v", section, found, err)
+			}
+			return nil
+		})
+	}
+}
@@ -0,0 +1,407 @@
+package gomime
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// TransferEncodingError is returned for malformed content of legacy
+// transfer encodings x-uuencode, x-yenc and x-binhex
+type TransferEncodingError struct {
+	Encoding string
+	Reason   string
+}
+
+func (e *TransferEncodingError) Error() string {
+	return fmt.Sprintf("gomime: bad %v data: %v", e.Encoding, e.Reason)
+}
+
+// NormalizeTransferEncoding returns canonical lower case name of
+// Content-Transfer-Encoding. It ignores case, surrounding whitespace and
+// quotes, accepts '_' or ' ' instead of '-' and maps aliases of legacy
+// encodings to x-uuencode, x-yenc and x-binhex.
+func NormalizeTransferEncoding(contentEncoding string) string {
+	name := strings.ToLower(strings.Trim(contentEncoding, " \t\r\n\"';"))
+	name = strings.NewReplacer("_", "-", " ", "-").Replace(name)
+	switch name {
+	case "quotedprintable", "quoted-printabl", "qp":
+		return "quoted-printable"
+	case "base-64", "b64":
+		return "base64"
+	case "7-bit":
+		return "7bit"
+	case "8-bit":
+		return "8bit"
+	case "uuencode", "x-uuencode", "uue", "x-uue", "uuencoded", "x-uuencoded":
+		return "x-uuencode"
+	case "yenc", "x-yenc":
+		return "x-yenc"
+	case "binhex", "x-binhex", "binhex40", "x-binhex40", "mac-binhex40", "binhex4.0":
+		return "x-binhex"
+	}
+	return name
+}
+
+// maxLegacyLineLength limits line of uuencode and yEnc content, longer
+// line is not buffered and fails with TransferEncodingError
+const maxLegacyLineLength = 4096
+
+// lineDecoder decodes content of legacy encodings line by line, so that
+// only one line is kept in memory
+type lineDecoder struct {
+	r        *bufio.Reader
+	encoding string
+	// decode returns decoded line without line break, done is true for
+	// the last line of encoded content
+	decode func(line []byte) (decoded []byte, done bool, err error)
+	// finish checks the content when the last line was decoded
+	finish func() error
+	out    []byte
+	err    error
+}
+
+func newLineDecoder(r io.Reader, encoding string, decode func([]byte) ([]byte, bool, error), finish func() error) *lineDecoder {
+	return &lineDecoder{
+		r:        bufio.NewReaderSize(r, maxLegacyLineLength),
+		encoding: encoding,
+		decode:   decode,
+		finish:   finish,
+	}
+}
+
+func (d *lineDecoder) Read(p []byte) (n int, err error) {
+	for len(d.out) == 0 && d.err == nil {
+		line, errRead := d.r.ReadSlice('\n')
+		if errRead == bufio.ErrBufferFull {
+			d.err = &TransferEncodingError{d.encoding, fmt.Sprintf("line longer than %d bytes", maxLegacyLineLength)}
+			break
+		}
+		decoded, done, errDecode := d.decode(bytes.TrimRight(line, "\r\n"))
+		d.out = decoded
+		switch {
+		case errDecode != nil:
+			d.err = errDecode
+		case done || errRead == io.EOF:
+			if d.err = d.finish(); d.err == nil {
+				d.err = io.EOF
+			}
+		case errRead != nil:
+			d.err = errRead
+		}
+	}
+	n = copy(p, d.out)
+	if d.out = d.out[n:]; len(d.out) == 0 && n == 0 {
+		err = d.err
+	}
+	return
+}
+
+// newUUDecoder returns decoder of the first file of uuencoded data, text
+// before the begin line is ignored
+func newUUDecoder(r io.Reader) io.Reader {
+	started, ended := false, false
+	decode := func(line []byte) ([]byte, bool, error) {
+		if !started {
+			started = bytes.HasPrefix(line, []byte("begin "))
+			return nil, false, nil
+		}
+		if bytes.Equal(bytes.TrimSpace(line), []byte("end")) {
+			ended = true
+			return nil, true, nil
+		}
+		if len(line) == 0 {
+			return nil, false, nil
+		}
+		length := int((line[0] - ' ') & 0x3f)
+		var chunk []byte
+		for i := 1; len(chunk) < length; i += 4 {
+			var group [4]byte
+			for j := range group {
+				if i+j < len(line) {
+					// '`' is used instead of space
+					group[j] = (line[i+j] - ' ') & 0x3f
+				}
+			}
+			chunk = append(chunk, group[0]<<2|group[1]>>4, group[1]<<4|group[2]>>2, group[2]<<6|group[3])
+		}
+		return chunk[:length], false, nil
+	}
+	finish := func() error {
+		switch {
+		case !started:
+			return &TransferEncodingError{"x-uuencode", "missing begin line"}
+		case !ended:
+			return &TransferEncodingError{"x-uuencode", "missing end line"}
+		}
+		return nil
+	}
+	return newLineDecoder(r, "x-uuencode", decode, finish)
+}
+
+// parseYEncParams parses `key=value` parameters of yEnc keyword line. Value
+// of name is the rest of line.
+func parseYEncParams(line []byte) map[string]string {
+	params := map[string]string{}
+	fields := strings.Fields(string(line))
+	for i, field := range fields[1:] {
+		eq := strings.IndexByte(field, '=')
+		if eq < 0 {
+			continue
+		}
+		key := field[:eq]
+		if key == "name" {
+			params[key] = strings.Join(append([]string{field[eq+1:]}, fields[i+2:]...), " ")
+			break
+		}
+		params[key] = field[eq+1:]
+	}
+	return params
+}
+
+// newYEncDecoder returns decoder of yEnc data of one file or one part of
+// multi-part file. Size and CRC32 from the trailer are verified when
+// present.
+func newYEncDecoder(r io.Reader) io.Reader {
+	started, ended, escaped := false, false, false
+	var trailer map[string]string
+	size, crc := 0, uint32(0)
+	decode := func(line []byte) ([]byte, bool, error) {
+		switch {
+		case !started:
+			started = bytes.HasPrefix(line, []byte("=ybegin "))
+			return nil, false, nil
+		case bytes.HasPrefix(line, []byte("=ypart ")):
+			return nil, false, nil
+		case bytes.HasPrefix(line, []byte("=yend")):
+			ended, trailer = true, parseYEncParams(line)
+			return nil, true, nil
+		}
+		decoded := make([]byte, 0, len(line))
+		for _, c := range line {
+			switch {
+			case escaped:
+				decoded = append(decoded, c-64-42)
+				escaped = false
+			case c == '=':
+				escaped = true
+			default:
+				decoded = append(decoded, c-42)
+			}
+		}
+		size, crc = size+len(decoded), crc32.Update(crc, crc32.IEEETable, decoded)
+		return decoded, false, nil
+	}
+	finish := func() error {
+		switch {
+		case !started:
+			return &TransferEncodingError{"x-yenc", "missing =ybegin line"}
+		case !ended:
+			return &TransferEncodingError{"x-yenc", "missing =yend line"}
+		}
+		if expected, ok := trailer["size"]; ok && expected != strconv.Itoa(size) {
+			return &TransferEncodingError{"x-yenc", fmt.Sprintf("size %v does not match %v", expected, size)}
+		}
+		expected, ok := trailer["pcrc32"]
+		if !ok {
+			expected, ok = trailer["crc32"]
+		}
+		if value, err := strconv.ParseUint(expected, 16, 32); ok && err == nil && uint32(value) != crc {
+			return &TransferEncodingError{"x-yenc", "crc32 mismatch"}
+		}
+		return nil
+	}
+	return newLineDecoder(r, "x-yenc", decode, finish)
+}
+
+const binHexAlphabet = "!\"#$%&'()*+,-012345689@ABCDEFGHIJKLMNPQRSTUVXYZ[`abcdefhijklmpqr"
+
+// binHexRunLength is marker of repeated byte
+const binHexRunLength = 0x90
+
+// binHexPhase is part of BinHex stream which is decoded
+type binHexPhase int
+
+const (
+	binHexSearch binHexPhase = iota // text before ':' starting data
+	binHexHeader
+	binHexData
+	binHexDataCRC
+	binHexDone
+)
+
+// binHexChunkSize limits bytes decoded by one read of binHexDecoder
+const binHexChunkSize = 4096
+
+// binHexDecoder decodes data fork of BinHex 4.0 file. Run-length encoded
+// bytes are expanded while reading, at most binHexChunkSize and one run at
+// once.
+type binHexDecoder struct {
+	r           *bufio.Reader
+	phase       binHexPhase
+	atLineStart bool
+	// 6-bit characters to bytes
+	acc  uint32
+	bits uint
+	// run-length decoding
+	last       byte
+	hasLast    bool
+	runLength  bool
+	header     []byte
+	dataLength int
+	crc        uint16
+	crcBytes   int
+	out        []byte
+	err        error
+}
+
+func newBinHexDecoder(r io.Reader) io.Reader {
+	return &binHexDecoder{r: bufio.NewReader(r), atLineStart: true}
+}
+
+func (d *binHexDecoder) Read(p []byte) (n int, err error) {
+	for len(d.out) < binHexChunkSize && d.err == nil {
+		c, errRead := d.r.ReadByte()
+		switch {
+		case errRead == io.EOF && d.phase == binHexSearch:
+			d.err = &TransferEncodingError{"x-binhex", "missing start of data"}
+		case errRead == io.EOF:
+			d.err = &TransferEncodingError{"x-binhex", "missing end of data"}
+		case errRead != nil:
+			d.err = errRead
+		default:
+			d.decodeChar(c)
+		}
+		if d.err == nil && d.phase == binHexDone {
+			// the rest (e.g. resource fork) is ignored
+			d.err = io.EOF
+		}
+	}
+	n = copy(p, d.out)
+	if d.out = d.out[n:]; len(d.out) == 0 && n == 0 {
+		err = d.err
+	}
+	return
+}
+
+func (d *binHexDecoder) decodeChar(c byte) {
+	if d.phase == binHexSearch {
+		// data starts by ':' at the beginning of line
+		if c == ':' && d.atLineStart {
+			d.phase = binHexHeader
+		}
+		d.atLineStart = c == '\r' || c == '\n'
+		return
+	}
+	if c == ':' {
+		if d.phase == binHexHeader {
+			d.err = &TransferEncodingError{"x-binhex", "truncated header"}
+		} else {
+			d.err = &TransferEncodingError{"x-binhex", "truncated data fork"}
+		}
+		return
+	}
+	value := strings.IndexByte(binHexAlphabet, c)
+	if value < 0 {
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			d.err = &TransferEncodingError{"x-binhex", fmt.Sprintf("invalid character %q", c)}
+		}
+		return
+	}
+	d.acc = d.acc<<6 | uint32(value)
+	if d.bits += 6; d.bits >= 8 {
+		d.bits -= 8
+		d.decodeByte(byte(d.acc >> d.bits))
+	}
+}
+
+// decodeByte expands run-length encoding
+func (d *binHexDecoder) decodeByte(c byte) {
+	switch {
+	case d.runLength:
+		d.runLength = false
+		switch {
+		case c == 0:
+			d.emit(binHexRunLength)
+		case !d.hasLast:
+			d.err = &TransferEncodingError{"x-binhex", "run-length without byte"}
+		default:
+			for count := int(c); count > 1 && d.err == nil && d.phase != binHexDone; count-- {
+				d.emit(d.last)
+			}
+		}
+	case c == binHexRunLength:
+		d.runLength = true
+	default:
+		d.emit(c)
+	}
+}
+
+// emit consumes byte of decoded stream: header with name length, name,
+// version, type, creator, flags, data and resource fork lengths and CRC,
+// then data fork and its CRC
+func (d *binHexDecoder) emit(c byte) {
+	d.last, d.hasLast = c, true
+	switch d.phase {
+	case binHexHeader:
+		d.header = append(d.header, c)
+		headerLength := 1 + int(d.header[0]) + 1 + 4 + 4 + 2 + 4 + 4
+		if len(d.header) < headerLength+2 {
+			return
+		}
+		if !checkBinHexCRC(d.header) {
+			d.err = &TransferEncodingError{"x-binhex", "header crc mismatch"}
+			return
+		}
+		d.dataLength = int(binary.BigEndian.Uint32(d.header[headerLength-8:]))
+		if d.phase = binHexData; d.dataLength == 0 {
+			d.phase = binHexDataCRC
+		}
+	case binHexData:
+		d.out = append(d.out, c)
+		d.crc = updateBinHexCRC(d.crc, c)
+		if d.dataLength--; d.dataLength == 0 {
+			d.phase = binHexDataCRC
+		}
+	case binHexDataCRC:
+		d.crc = updateBinHexCRC(d.crc, c)
+		if d.crcBytes++; d.crcBytes < 2 {
+			return
+		}
+		if d.crc != 0 {
+			d.err = &TransferEncodingError{"x-binhex", "data fork crc mismatch"}
+			return
+		}
+		d.phase = binHexDone
+	}
+}
+
+// checkBinHexCRC verifies block followed by its CRC-16-CCITT. CRC of data
+// with appended correct CRC is zero.
+func checkBinHexCRC(block []byte) bool {
+	return binHexCRC(block) == 0
+}
+
+func binHexCRC(data []byte) (crc uint16) {
+	for _, c := range data {
+		crc = updateBinHexCRC(crc, c)
+	}
+	return
+}
+
+func updateBinHexCRC(crc uint16, c byte) uint16 {
+	crc ^= uint16(c) << 8
+	for i := 0; i < 8; i++ {
+		if crc&0x8000 != 0 {
+			crc = crc<<1 ^ 0x1021
+		} else {
+			crc <<= 1
+		}
+	}
+	return crc
+}
@@ -0,0 +1,234 @@
+package gomime
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTransferEncoding(t *testing.T) {
+	testData := map[string]string{
+		"Base64 ":           "base64",
+		"quoted_printable":  "quoted-printable",
+		" Quoted-Printable": "quoted-printable",
+		"\"7bit\"":          "7bit",
+		"x-uue":             "x-uuencode",
+		"X-UUEncode":        "x-uuencode",
+		"yEnc":              "x-yenc",
+		"mac-binhex40":      "x-binhex",
+		"x-unknown":         "x-unknown",
+		"":                  "",
+	}
+	for name, expected := range testData {
+		if normalized := NormalizeTransferEncoding(name); normalized != expected {
+			t.Errorf("expected %q for %q but have %q", expected, name, normalized)
+		}
+	}
+}
+
+// testBinaryData contains all byte values, runs and critical characters
+var testBinaryData = append(append([]byte("Cat\x00\r\n=.\x90\x90"), bytes.Repeat([]byte{'x'}, 300)...), func() (b []byte) {
+	for i := 0; i < 256; i++ {
+		b = append(b, byte(i))
+	}
+	return
+}()...)
+
+func uuencode(data []byte) string {
+	buf := &strings.Builder{}
+	buf.WriteString("begin 644 data.bin\n")
+	encodeChar := func(c byte) byte {
+		if c == 0 {
+			return '`'
+		}
+		return c + ' '
+	}
+	for len(data) > 0 {
+		line := data
+		if len(line) > 45 {
+			line = line[:45]
+		}
+		data = data[len(line):]
+		buf.WriteByte(encodeChar(byte(len(line))))
+		for i := 0; i < len(line); i += 3 {
+			var group [3]byte
+			copy(group[:], line[i:])
+			buf.WriteByte(encodeChar(group[0] >> 2))
+			buf.WriteByte(encodeChar((group[0]<<4 | group[1]>>4) & 0x3f))
+			buf.WriteByte(encodeChar((group[1]<<2 | group[2]>>6) & 0x3f))
+			buf.WriteByte(encodeChar(group[2] & 0x3f))
+		}
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("`\nend\n")
+	return buf.String()
+}
+
+func yencode(data []byte) string {
+	buf := &strings.Builder{}
+	fmt.Fprintf(buf, "=ybegin line=128 size=%d name=my data.bin\r\n", len(data))
+	for i, c := range data {
+		switch c += 42; c {
+		case 0, '\r', '\n', '=':
+			buf.WriteByte('=')
+			c += 64
+		}
+		buf.WriteByte(c)
+		if i%128 == 127 {
+			buf.WriteString("\r\n")
+		}
+	}
+	fmt.Fprintf(buf, "\r\n=yend size=%d crc32=%08x\r\n", len(data), crc32.ChecksumIEEE(data))
+	return buf.String()
+}
+
+func binhex(data []byte) string {
+	appendCRC := func(block []byte) []byte {
+		crc := binHexCRC(block)
+		return append(block, byte(crc>>8), byte(crc))
+	}
+	name := "data.bin"
+	header := append([]byte{byte(len(name))}, name...)
+	header = append(header, 0)
+	header = append(header, "TEXTttxt\x00\x00"...)
+	header = append(header, make([]byte, 8)...)
+	binary.BigEndian.PutUint32(header[len(header)-8:], uint32(len(data)))
+	stream := appendCRC(header)
+	stream = append(stream, appendCRC(append([]byte{}, data...))...)
+	// empty resource fork with its CRC
+	stream = append(stream, 0, 0)
+
+	// run-length encoding
+	var packed []byte
+	for i := 0; i < len(stream); {
+		c, n := stream[i], 1
+		for i+n < len(stream) && stream[i+n] == c && n < 255 {
+			n++
+		}
+		if c == binHexRunLength {
+			packed, n = append(packed, binHexRunLength, 0), 1
+		} else if n > 2 {
+			packed = append(packed, c, binHexRunLength, byte(n))
+		} else {
+			packed, n = append(packed, c), 1
+		}
+		i += n
+	}
+
+	buf := &strings.Builder{}
+	buf.WriteString("(This file must be converted with BinHex 4.0)\r\n:")
+	var acc uint32
+	var bits uint
+	column := 1
+	writeChar := func(value uint32) {
+		buf.WriteByte(binHexAlphabet[value&0x3f])
+		if column++; column == 64 {
+			buf.WriteString("\r\n")
+			column = 0
+		}
+	}
+	for _, c := range packed {
+		acc, bits = acc<<8|uint32(c), bits+8
+		for bits >= 6 {
+			bits -= 6
+			writeChar(acc >> bits)
+		}
+	}
+	if bits > 0 {
+		writeChar(acc << (6 - bits))
+	}
+	buf.WriteString(":\r\n")
+	return buf.String()
+}
+
+func TestDecodeLegacyTransferEncodings(t *testing.T) {
+	testData := []struct {
+		encoding, encoded string
+		expected          []byte
+	}{
+		{"x-uuencode", "begin 644 cat.txt\n#0V%T\n`\nend\n", []byte("Cat")},
+		{"x-uue", "preamble\r\n" + uuencode(testBinaryData), testBinaryData},
+		{"yenc", yencode(testBinaryData), testBinaryData},
+		{"x-binhex", "Some text before\r\n" + binhex(testBinaryData), testBinaryData},
+	}
+	for _, val := range testData {
+		decoded, err := ioutil.ReadAll(DecodeContentEncoding(strings.NewReader(val.encoded), val.encoding))
+		if err != nil {
+			t.Errorf("%v: unexpected error %v", val.encoding, err)
+		}
+		if !bytes.Equal(decoded, val.expected) {
+			t.Errorf("%v: expected %q but have %q", val.encoding, val.expected, decoded)
+		}
+	}
+
+	corrupted := map[string]string{
+		"x-uuencode": "#0V%T\n",
+		"x-yenc":     strings.Replace(yencode([]byte("data")), "=yend size=4", "=yend size=5", 1),
+		"x-binhex":   strings.Replace(binhex([]byte("data")), "!", "\"", 1),
+	}
+	for encoding, encoded := range corrupted {
+		_, err := ioutil.ReadAll(DecodeContentEncoding(strings.NewReader(encoded), encoding))
+		if encodingErr, ok := err.(*TransferEncodingError); !ok || encodingErr.Encoding != encoding {
+			t.Errorf("%v: expected TransferEncodingError but have %v", encoding, err)
+		}
+	}
+}
+
+func TestDecodeLongLine(t *testing.T) {
+	line := strings.Repeat("M", 1<<20)
+	testData := map[string]string{
+		"x-uuencode": "begin 644 a.bin\n" + line + "\nend\n",
+		"x-yenc":     "=ybegin line=128 size=1 name=a.bin\n" + line + "\n=yend size=1\n",
+	}
+	for encoding, encoded := range testData {
+		d := DecodeContentEncoding(strings.NewReader(encoded), encoding)
+		if size := d.(*lineDecoder).r.Size(); size != maxLegacyLineLength {
+			t.Errorf("%v: unexpected buffer size %v", encoding, size)
+		}
+		_, err := ioutil.ReadAll(d)
+		if encodingErr, ok := err.(*TransferEncodingError); !ok || encodingErr.Encoding != encoding {
+			t.Errorf("%v: expected TransferEncodingError but have %v", encoding, err)
+		}
+	}
+}
+
+func TestDecodeBinHexIncrementally(t *testing.T) {
+	// each 255 bytes are run-length encoded to 3 bytes
+	data := make([]byte, 1<<20)
+	encoded := binhex(data)
+
+	d := DecodeContentEncoding(strings.NewReader(encoded), "x-binhex").(*binHexDecoder)
+	chunk := make([]byte, 16)
+	if _, err := io.ReadFull(d, chunk); err != nil {
+		t.Fatal(err)
+	}
+	if cap(d.out) > 2*binHexChunkSize {
+		t.Errorf("decoder buffered %v bytes", cap(d.out))
+	}
+	decoded, err := ioutil.ReadAll(d)
+	if err != nil || len(decoded)+len(chunk) != len(data) {
+		t.Errorf("unexpected decoded length %v, %v", len(decoded)+len(chunk), err)
+	}
+}
+
+func TestParseLegacyTransferEncoding(t *testing.T) {
+	message := "Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: X-UUE \r\n" +
+		"\r\n" +
+		uuencode([]byte("legacy"))
+	p, err := Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Warnings) != 0 || p.TransferEncoding != "x-uuencode" {
+		t.Errorf("unexpected part %v %v", p.TransferEncoding, p.Warnings)
+	}
+	if decoded, err := ioutil.ReadAll(p.DecodedBody()); err != nil || string(decoded) != "legacy" {
+		t.Errorf("unexpected decoded body %q, %v", decoded, err)
+	}
+}
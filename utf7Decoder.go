@@ -10,15 +10,27 @@ import (
 	"golang.org/x/text/transform"
 )
 
-// utf7Decoder copied from: https://github.com/cention-sany/utf7/blob/master/utf7.go
-// We need `encoding.Decoder` instead of function `UTF7DecodeBytes`
+// utf7Decoder is streaming UTF-7 decoder. Unlike the original from
+// https://github.com/cention-sany/utf7/blob/master/utf7.go it keeps state
+// of BASE64 sequence between calls so that sequences of any length can be
+// decoded by transform.Reader.
 type utf7Decoder struct {
-	transform.NopResetter
+	inBase64 bool
+	// empty is true until the first BASE64 character after '+'
+	empty bool
+	bits  uint
+	acc   uint32
+	// high is pending high surrogate
+	high rune
 }
 
 // NewUtf7Decoder return decoder for utf7
 func NewUtf7Decoder() *encoding.Decoder {
-	return &encoding.Decoder{Transformer: utf7Decoder{}}
+	return &encoding.Decoder{Transformer: &utf7Decoder{}}
+}
+
+func (d *utf7Decoder) Reset() {
+	*d = utf7Decoder{}
 }
 
 const (
@@ -34,137 +46,107 @@ const modifiedbase64 = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123
 
 var u7enc = base64.NewEncoding(modifiedbase64)
 
-func isModifiedBase64(r byte) bool {
-	if r >= 'A' && r <= 'Z' {
-		return true
-	} else if r >= 'a' && r <= 'z' {
-		return true
-	} else if r >= '0' && r <= '9' {
-		return true
-	} else if r == '+' || r == '/' {
-		return true
+// u7values maps modified BASE64 characters to their values, other
+// characters are -1
+var u7values = func() (values [256]int8) {
+	for i := range values {
+		values[i] = -1
 	}
-	return false
-}
+	for i := 0; i < len(modifiedbase64); i++ {
+		values[modifiedbase64[i]] = int8(i)
+	}
+	return
+}()
 
-func (d utf7Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
-	var implicit bool
-	var tmp int
+// isUtf7Allowed returns true for characters allowed outside of BASE64
+func isUtf7Allowed(c byte) bool {
+	return (c >= u7min && c <= u7max && c != '~' && c != '\\') || c == '\t' || c == '\r' || c == '\n'
+}
 
-	nd, n := len(dst), len(src)
-	if n == 0 && !atEOF {
-		return 0, 0, transform.ErrShortSrc
-	}
-	for ; nSrc < n; nSrc++ {
-		if nDst >= nd {
-			return nDst, nSrc, transform.ErrShortDst
-		}
-		if c := src[nSrc]; ((c < u7min || c > u7max) &&
-			c != '\t' && c != '\r' && c != '\n') ||
-			c == '~' || c == '\\' {
-			return nDst, nSrc, ErrBadUTF7 // Illegal code point in ASCII mode
-		} else if c != '+' {
-			dst[nDst] = c // character is self-representing
-			nDst++
-			continue
-		}
-		// found '+'
-		start := nSrc + 1
-		tmp = nSrc // nSrc still points to '+', tmp points to the end of BASE64
-		// Find the end of the Base64 or "+-" segment
-		implicit = false
-		for tmp++; tmp < n && src[tmp] != '-'; tmp++ {
-			if !isModifiedBase64(src[tmp]) {
-				if tmp == start {
-					return nDst, tmp, ErrBadUTF7 // '+' next char must modified base64
+func (d *utf7Decoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	for ; nSrc < len(src); nSrc++ {
+		c := src[nSrc]
+		if d.inBase64 {
+			if value := u7values[c]; value >= 0 {
+				if len(dst)-nDst < utf8.UTFMax {
+					return nDst, nSrc, transform.ErrShortDst
 				}
-				// implicit shift back to ASCII - no need '-' character
-				implicit = true
-				break
-			}
-		}
-		if tmp == start {
-			if tmp == n {
-				// did not find '-' sign and '+' is the last character
-				// total nSrc not includes '+'
-				if atEOF {
-					return nDst, nSrc, ErrBadUTF7 // '+' can not be at the end
+				d.acc, d.bits, d.empty = d.acc<<6|uint32(value), d.bits+6, false
+				if d.bits >= 16 {
+					d.bits -= 16
+					var r rune
+					if r, err = d.decodeUnit(uint16(d.acc >> d.bits)); err != nil {
+						return
+					}
+					if r >= 0 {
+						nDst += utf8.EncodeRune(dst[nDst:], r)
+					}
 				}
-				// '+' can not be at the end, the source si too short
-				return nDst, nSrc, transform.ErrShortSrc
-			}
-			dst[nDst] = '+' // Escape sequence "+-"
-			nDst++
-		} else if tmp == n && !atEOF {
-			// no eof found, the source is too short
-			return nDst, nSrc, transform.ErrShortSrc
-		} else if b := utf7dec(src[start:tmp]); len(b) > 0 {
-			if len(b)+nDst > nd {
-				// need more space in dst for the decoded modified BASE64 unicode
-				// total nSrc is not including '+'
-				return nDst, nSrc, transform.ErrShortDst
+				continue
 			}
-			copy(dst[nDst:], b) // Control or non-ASCII code points in Base64
-			nDst += len(b)
-			if implicit {
-				if nDst >= nd {
-					return nDst, tmp, transform.ErrShortDst
+
+			if d.empty && c == '-' {
+				// escape sequence "+-"
+				if nDst >= len(dst) {
+					return nDst, nSrc, transform.ErrShortDst
 				}
-				dst[nDst] = src[tmp] // implicit shift
+				dst[nDst] = '+'
 				nDst++
+				d.inBase64 = false
+				continue
 			}
-			if tmp == n {
-				return nDst, tmp, nil
+			if err = d.endBase64(); err != nil {
+				return
 			}
-		} else {
-			return nDst, nSrc, ErrBadUTF7 // bad encoding
+			if c == '-' {
+				continue
+			}
+			// implicit shift back to ASCII
+		}
+
+		if !isUtf7Allowed(c) {
+			return nDst, nSrc, ErrBadUTF7
+		}
+		if c == '+' {
+			d.inBase64, d.empty = true, true
+			continue
+		}
+		if nDst >= len(dst) {
+			return nDst, nSrc, transform.ErrShortDst
 		}
-		nSrc = tmp
+		dst[nDst] = c
+		nDst++
+	}
+	if atEOF && d.inBase64 {
+		err = d.endBase64()
 	}
 	return
 }
 
-// utf7dec extracts UTF-16-BE bytes from Base64 data and converts them to UTF-8.
-// A nil slice is returned if the encoding is invalid.
-func utf7dec(b64 []byte) []byte {
-	var b []byte
-
-	// Allocate a single block of memory large enough to store the Base64 data
-	// (if padding is required), UTF-16-BE bytes, and decoded UTF-8 bytes.
-	// Since a 2-byte UTF-16 sequence may expand into a 3-byte UTF-8 sequence,
-	// double the space allocation for UTF-8.
-	if n := len(b64); b64[n-1] == '=' {
-		return nil
-	} else if n&3 == 0 {
-		b = make([]byte, u7enc.DecodedLen(n)*3)
-	} else {
-		n += 4 - n&3
-		b = make([]byte, n+u7enc.DecodedLen(n)*3)
-		copy(b[copy(b, b64):n], []byte("=="))
-		b64, b = b[:n], b[n:]
-	}
-
-	// Decode Base64 into the first 1/3rd of b
-	n, err := u7enc.Decode(b, b64)
-	if err != nil || n&1 == 1 {
-		return nil
+// decodeUnit returns rune of UTF-16 unit or -1 for high surrogate which
+// waits for its pair
+func (d *utf7Decoder) decodeUnit(unit uint16) (rune, error) {
+	r := rune(unit)
+	switch {
+	case d.high != 0:
+		if r = utf16.DecodeRune(d.high, r); r == uRepl {
+			return 0, ErrBadUTF7
+		}
+		d.high = 0
+	case utf16.IsSurrogate(r) && r < 0xdc00:
+		d.high = r
+		return -1, nil
+	case utf16.IsSurrogate(r):
+		return 0, ErrBadUTF7
 	}
+	return r, nil
+}
 
-	// Decode UTF-16-BE into the remaining 2/3rds of b
-	b, s := b[:n], b[n:]
-	j := 0
-	for i := 0; i < n; i += 2 {
-		r := rune(b[i])<<8 | rune(b[i+1])
-		if utf16.IsSurrogate(r) {
-			if i += 2; i == n {
-				return nil
-			}
-			r2 := rune(b[i])<<8 | rune(b[i+1])
-			if r = utf16.DecodeRune(r, r2); r == uRepl {
-				return nil
-			}
-		}
-		j += utf8.EncodeRune(s[j:], r)
+// endBase64 checks that BASE64 sequence ended at UTF-16 boundary
+func (d *utf7Decoder) endBase64() error {
+	if d.empty || d.high != 0 || d.bits >= 6 {
+		return ErrBadUTF7
 	}
-	return s[:j]
+	d.inBase64, d.bits, d.acc = false, 0, 0
+	return nil
 }
@@ -0,0 +1,111 @@
+package gomime
+
+import (
+	"encoding/base64"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// UTF7 is RFC 2152 UTF-7 encoding
+var UTF7 encoding.Encoding = utf7Encoding{}
+
+type utf7Encoding struct{}
+
+func (utf7Encoding) NewDecoder() *encoding.Decoder {
+	return NewUtf7Decoder()
+}
+
+func (utf7Encoding) NewEncoder() *encoding.Encoder {
+	return NewUtf7Encoder()
+}
+
+// utf7Encoder writes printable ASCII (except characters rejected by
+// utf7Decoder) directly and other characters as modified BASE64 of
+// UTF-16-BE. Each BASE64 sequence is explicitly terminated by '-'.
+type utf7Encoder struct {
+	transform.NopResetter
+}
+
+// NewUtf7Encoder return encoder for utf7
+func NewUtf7Encoder() *encoding.Encoder {
+	return &encoding.Encoder{Transformer: utf7Encoder{}}
+}
+
+var u7encRaw = u7enc.WithPadding(base64.NoPadding)
+
+// isUtf7Direct returns true for characters which represent themselves
+func isUtf7Direct(r rune) bool {
+	return (r >= u7min && r <= u7max && r != '+' && r != '~' && r != '\\') ||
+		r == '\t' || r == '\r' || r == '\n'
+}
+
+func (e utf7Encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	return encodeUtf7(dst, src, atEOF, '+', isUtf7Direct, u7encRaw)
+}
+
+// encodeUtf7 is shared by UTF-7 and IMAP modified UTF-7 encoders which
+// differ in shift character, direct characters and BASE64 alphabet
+func encodeUtf7(dst, src []byte, atEOF bool, shift byte, isDirect func(rune) bool, enc *base64.Encoding) (nDst, nSrc int, err error) {
+	for nSrc < len(src) {
+		if !utf8.FullRune(src[nSrc:]) && !atEOF {
+			return nDst, nSrc, transform.ErrShortSrc
+		}
+		r, size := utf8.DecodeRune(src[nSrc:])
+
+		if r == rune(shift) {
+			if len(dst)-nDst < 2 {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst], dst[nDst+1] = shift, '-'
+			nDst, nSrc = nDst+2, nSrc+size
+			continue
+		}
+		if isDirect(r) {
+			if nDst >= len(dst) {
+				return nDst, nSrc, transform.ErrShortDst
+			}
+			dst[nDst] = byte(r)
+			nDst, nSrc = nDst+1, nSrc+size
+			continue
+		}
+
+		// collect characters which fit to dst as UTF-16-BE
+		var units []uint16
+		end := nSrc
+		for end < len(src) {
+			if !utf8.FullRune(src[end:]) && !atEOF {
+				break
+			}
+			r, size := utf8.DecodeRune(src[end:])
+			if isDirect(r) || r == rune(shift) {
+				break
+			}
+			next := append(units, utf16.Encode([]rune{r})...)
+			if len(dst)-nDst < enc.EncodedLen(len(next)*2)+2 {
+				break
+			}
+			units, end = next, end+size
+		}
+		if len(units) == 0 {
+			if end < len(src) && !utf8.FullRune(src[end:]) {
+				return nDst, nSrc, transform.ErrShortSrc
+			}
+			return nDst, nSrc, transform.ErrShortDst
+		}
+
+		b := make([]byte, len(units)*2)
+		for i, unit := range units {
+			b[2*i], b[2*i+1] = byte(unit>>8), byte(unit)
+		}
+		dst[nDst] = shift
+		nDst++
+		enc.Encode(dst[nDst:], b)
+		nDst += enc.EncodedLen(len(b))
+		dst[nDst] = '-'
+		nDst, nSrc = nDst+1, end
+	}
+	return
+}
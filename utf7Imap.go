@@ -0,0 +1,81 @@
+package gomime
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/transform"
+)
+
+// ErrBadModifiedUTF7 is returned for invalid IMAP mailbox name
+var ErrBadModifiedUTF7 = errors.New("utf7: bad modified utf-7 encoding")
+
+var imapEnc = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").WithPadding(base64.NoPadding)
+
+// isImapDirect returns true for characters which represent themselves in
+// modified UTF-7
+func isImapDirect(r rune) bool {
+	return r >= u7min && r <= u7max && r != '&'
+}
+
+type imapUtf7Encoder struct {
+	transform.NopResetter
+}
+
+func (imapUtf7Encoder) Transform(dst, src []byte, atEOF bool) (nDst, nSrc int, err error) {
+	return encodeUtf7(dst, src, atEOF, '&', isImapDirect, imapEnc)
+}
+
+// EncodeModifiedUTF7 encodes IMAP mailbox name to modified UTF-7 as
+// defined in RFC 3501 section 5.1.3
+func EncodeModifiedUTF7(name string) string {
+	encoded, _, _ := transform.String(imapUtf7Encoder{}, name)
+	return encoded
+}
+
+// DecodeModifiedUTF7 decodes IMAP mailbox name from modified UTF-7 as
+// defined in RFC 3501 section 5.1.3
+func DecodeModifiedUTF7(name string) (string, error) {
+	decoded := &strings.Builder{}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if c < u7min || c > u7max {
+			return "", ErrBadModifiedUTF7
+		}
+		if c != '&' {
+			decoded.WriteByte(c)
+			continue
+		}
+
+		end := strings.IndexByte(name[i+1:], '-')
+		if end < 0 {
+			return "", ErrBadModifiedUTF7
+		}
+		encoded := name[i+1 : i+1+end]
+		i += end + 1
+		if encoded == "" {
+			decoded.WriteByte('&')
+			continue
+		}
+
+		b, err := imapEnc.DecodeString(encoded)
+		if err != nil || len(b)%2 == 1 {
+			return "", ErrBadModifiedUTF7
+		}
+		units := make([]uint16, len(b)/2)
+		for j := range units {
+			units[j] = uint16(b[2*j])<<8 | uint16(b[2*j+1])
+		}
+		for _, r := range utf16.Decode(units) {
+			// printable ASCII must represent itself
+			if r == utf8.RuneError || isImapDirect(r) || r == '&' {
+				return "", ErrBadModifiedUTF7
+			}
+			decoded.WriteRune(r)
+		}
+	}
+	return decoded.String(), nil
+}
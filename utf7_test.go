@@ -0,0 +1,114 @@
+package gomime
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"golang.org/x/text/transform"
+)
+
+func TestUtf7Encoder(t *testing.T) {
+	testData := []string{
+		"Hi Mom -☺-!",
+		"日本語",
+		"A≢Α.",
+		"1 + 1 = 2 ~ \\ \r\n\t",
+		"emoji 😀 and ž",
+		"",
+	}
+
+	for _, val := range testData {
+		encoded, err := UTF7.NewEncoder().String(val)
+		if err != nil {
+			t.Error("encode error", val, err)
+			continue
+		}
+		for _, c := range []byte(encoded) {
+			if c >= 0x80 || c == '~' || c == '\\' {
+				t.Errorf("unexpected character %q in encoded %q", c, encoded)
+			}
+		}
+		decoded, err := UTF7.NewDecoder().String(encoded)
+		if err != nil || decoded != val {
+			t.Errorf("unexpected round trip of %q: %q (%q) %v", val, decoded, encoded, err)
+		}
+	}
+
+	if encoded, _ := NewUtf7Encoder().String("Hi Mom -☺-!"); encoded != "Hi Mom -+Jjo--!" {
+		t.Errorf("unexpected encoded %q", encoded)
+	}
+	if encoded, _ := EncodeCharset([]byte("a+b"), "utf-7"); string(encoded) != "a+-b" {
+		t.Errorf("unexpected encoded %q", encoded)
+	}
+}
+
+func TestUtf7EncoderShortBuffers(t *testing.T) {
+	message := bytes.Repeat([]byte("ž日本 plain "), 100)
+
+	buf := &bytes.Buffer{}
+	w := transform.NewWriter(buf, NewUtf7Encoder())
+	for i := 0; i < len(message); i += 7 {
+		end := i + 7
+		if end > len(message) {
+			end = len(message)
+		}
+		if _, err := w.Write(message[i:end]); err != nil {
+			t.Fatal("write error", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal("close error", err)
+	}
+
+	decoded, err := NewUtf7Decoder().Bytes(buf.Bytes())
+	if err != nil || !bytes.Equal(decoded, message) {
+		t.Errorf("unexpected round trip %q %v", decoded, err)
+	}
+}
+
+func TestUtf7DecoderStreaming(t *testing.T) {
+	// base64 run longer than buffer of transform.Reader
+	message := strings.Repeat("日本語ž", 2000) + " + plain"
+	encoded, err := NewUtf7Encoder().String(message)
+	if err != nil {
+		t.Fatal("encode error", err)
+	}
+	decoded, err := ioutil.ReadAll(transform.NewReader(iotest.OneByteReader(strings.NewReader(encoded)), NewUtf7Decoder()))
+	if err != nil || string(decoded) != message {
+		t.Errorf("unexpected streamed decoding %v", err)
+	}
+
+	for _, invalid := range []string{"a+", "+2D3", "a+AGEA"} {
+		if _, err := NewUtf7Decoder().String(invalid); err == nil {
+			t.Errorf("%q: expected error", invalid)
+		}
+	}
+}
+
+func TestModifiedUTF7(t *testing.T) {
+	testData := []struct{ decoded, encoded string }{
+		{"INBOX", "INBOX"},
+		{"~peter/mail/台北/日本語", "~peter/mail/&U,BTFw-/&ZeVnLIqe-"},
+		{"Tom & Jerry", "Tom &- Jerry"},
+		{"Přijaté", "P&AVk-ijat&AOk-"},
+		{"😀", "&2D3eAA-"},
+	}
+
+	for _, val := range testData {
+		if encoded := EncodeModifiedUTF7(val.decoded); encoded != val.encoded {
+			t.Errorf("expected %q but have %q", val.encoded, encoded)
+		}
+		if decoded, err := DecodeModifiedUTF7(val.encoded); err != nil || decoded != val.decoded {
+			t.Errorf("expected %q but have %q %v", val.decoded, decoded, err)
+		}
+	}
+
+	for _, bad := range []string{"&U,BTFw", "&Jjo!", "&AGE-", "&2D3e-", "tab\t", "ž"} {
+		if _, err := DecodeModifiedUTF7(bad); err != ErrBadModifiedUTF7 {
+			t.Errorf("expected error for %q but have %v", bad, err)
+		}
+	}
+}
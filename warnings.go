@@ -0,0 +1,226 @@
+package gomime
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// WarningCode identifies kind of non-fatal problem found in message
+type WarningCode int
+
+const (
+	// WarningUnknownCharset is reported for charset which is not supported
+	WarningUnknownCharset WarningCode = iota + 1
+	// WarningMissingCharset is reported for non-utf8 text without charset
+	WarningMissingCharset
+	// WarningBadCharset is reported when content is not valid in its charset
+	WarningBadCharset
+	// WarningUnknownTransferEncoding is reported for unsupported
+	// Content-Transfer-Encoding, the part is used without decoding
+	WarningUnknownTransferEncoding
+	// WarningBadBase64 is reported for malformed base64 content
+	WarningBadBase64
+	// WarningBadQuotedPrintable is reported for malformed quoted-printable
+	// content
+	WarningBadQuotedPrintable
+	// WarningMissingBoundaryTerminator is reported for multipart without
+	// close delimiter, the last part ends at the end of message
+	WarningMissingBoundaryTerminator
+	// WarningBadEmbeddedMessage is reported for message/rfc822 part which
+	// can not be parsed, it is kept as leaf
+	WarningBadEmbeddedMessage
+	// WarningCharsetMismatch is reported when content does not look like
+	// text in its declared charset, the declared charset is still used
+	WarningCharsetMismatch
+	// WarningBadTransferEncoding is reported for malformed content in
+	// other transfer encodings than base64 and quoted-printable
+	WarningBadTransferEncoding
+	// WarningMissingBoundary is reported for multipart without boundary,
+	// it is kept as text/plain leaf
+	WarningMissingBoundary
+)
+
+var warningCodeNames = map[WarningCode]string{
+	WarningUnknownCharset:            "unknown charset",
+	WarningMissingCharset:            "missing charset",
+	WarningBadCharset:                "bad charset",
+	WarningUnknownTransferEncoding:   "unknown transfer encoding",
+	WarningBadBase64:                 "bad base64",
+	WarningBadQuotedPrintable:        "bad quoted-printable",
+	WarningMissingBoundaryTerminator: "missing boundary terminator",
+	WarningBadEmbeddedMessage:        "bad embedded message",
+	WarningCharsetMismatch:           "charset mismatch",
+	WarningBadTransferEncoding:       "bad transfer encoding",
+	WarningMissingBoundary:           "missing boundary",
+}
+
+func (code WarningCode) String() string {
+	if name, ok := warningCodeNames[code]; ok {
+		return name
+	}
+	return "warning " + strconv.Itoa(int(code))
+}
+
+// Warning describes problem which did not stop processing of the message,
+// the affected part was used as is or after repair.
+type Warning struct {
+	Code WarningCode
+	// Section is IMAP section path of the affected part (e.g. "2.1"),
+	// empty for the top-level multipart.
+	Section string
+	Err     error
+}
+
+func (w Warning) String() string {
+	msg := w.Code.String()
+	if w.Section != "" {
+		msg = fmt.Sprintf("part %s: %s", w.Section, msg)
+	}
+	if w.Err != nil {
+		msg += ": " + w.Err.Error()
+	}
+	return msg
+}
+
+// Diagnostics collects warnings reported while visiting message. One
+// instance can be shared by MimeVisitor and collectors, the visitor keeps
+// track of the section of visited part so that warnings reported by
+// collectors carry it. Nil Diagnostics ignores all warnings.
+type Diagnostics struct {
+	Warnings []Warning
+	// Handler is called for each warning when set
+	Handler func(Warning)
+
+	section []int
+}
+
+// NewDiagnostics returns empty diagnostics
+func NewDiagnostics() *Diagnostics {
+	return &Diagnostics{}
+}
+
+func (d *Diagnostics) setSection(section []int) {
+	if d != nil {
+		d.section = section
+	}
+}
+
+func (d *Diagnostics) warn(code WarningCode, err error) {
+	if d == nil {
+		return
+	}
+	w := Warning{Code: code, Section: formatSection(d.section), Err: err}
+	d.Warnings = append(d.Warnings, w)
+	if d.Handler != nil {
+		d.Handler(w)
+	}
+}
+
+// warnCharset classifies error returned by DecodeCharset
+func (d *Diagnostics) warnCharset(params map[string]string, err error) {
+	charset, ok := params["charset"]
+	switch {
+	case !ok:
+		d.warn(WarningMissingCharset, err)
+	case !isKnownCharset(charset):
+		d.warn(WarningUnknownCharset, err)
+	default:
+		d.warn(WarningBadCharset, err)
+	}
+}
+
+// decodeCharset decodes text by DecodeCharset and reports problems with
+// charset. The original is returned when decoding fails.
+func (d *Diagnostics) decodeCharset(original []byte, mediaType string, params map[string]string) []byte {
+	decoded, detected, err := decodeCharset(original, mediaType, params)
+	if err != nil {
+		d.warnCharset(params, err)
+		return original
+	}
+	d.checkCharset(original, mediaType, params, detected)
+	return decoded
+}
+
+// decodeCharsetReader is streaming variant of decodeCharset. Errors of
+// the returned reader are not reported.
+func (d *Diagnostics) decodeCharsetReader(r io.Reader, mediaType string, params map[string]string) io.Reader {
+	decoded, sample, detected, err := decodeCharsetReader(r, mediaType, params)
+	if err != nil {
+		d.warnCharset(params, err)
+		return decoded
+	}
+	d.checkCharset(sample, mediaType, params, detected)
+	if _, ok := params["charset"]; !ok && detected == "" && d != nil && strings.HasPrefix(mediaType, "text/") {
+		// only the beginning of text was checked
+		decoded = &utf8Checker{r: decoded, d: d}
+	}
+	return decoded
+}
+
+// utf8Checker reports text without charset which is not valid UTF-8 after
+// its beginning. The text is passed unchanged.
+type utf8Checker struct {
+	r        io.Reader
+	d        *Diagnostics
+	pending  []byte // incomplete rune at the end of previous read
+	reported bool
+}
+
+func (c *utf8Checker) Read(p []byte) (n int, err error) {
+	n, err = c.r.Read(p)
+	if c.reported {
+		return
+	}
+	data := p[:n]
+	if len(c.pending) > 0 {
+		data = append(c.pending, data...)
+	}
+	c.pending = nil
+	if err == nil {
+		complete := trimIncompleteRune(data)
+		c.pending = append(c.pending, data[len(complete):]...)
+		data = complete
+	}
+	if !utf8.Valid(data) {
+		c.reported = true
+		c.d.warn(WarningMissingCharset, fmt.Errorf("non-utf8 content without charset specification"))
+	}
+	return
+}
+
+// checkCharset reports charset detected for text without charset and
+// declared charset which does not match the text
+func (d *Diagnostics) checkCharset(text []byte, mediaType string, params map[string]string, detected string) {
+	if detected != "" {
+		d.warn(WarningMissingCharset, fmt.Errorf("detected %v", detected))
+	}
+	// detection is not for free, skip it when nobody listens
+	if charset, ok := params["charset"]; ok && d != nil && strings.HasPrefix(mediaType, "text/") {
+		if detected, mismatch := detectCharsetMismatch(text, charset); mismatch {
+			d.warn(WarningCharsetMismatch, fmt.Errorf("declared %v, detected %v", charset, detected))
+		}
+	}
+}
+
+// warnTransferEncoding reports error of content transfer decoding
+func (d *Diagnostics) warnTransferEncoding(contentEncoding string, err error) {
+	switch NormalizeTransferEncoding(contentEncoding) {
+	case "base64":
+		d.warn(WarningBadBase64, err)
+	case "quoted-printable":
+		d.warn(WarningBadQuotedPrintable, err)
+	case "x-uuencode", "x-yenc", "x-binhex":
+		d.warn(WarningBadTransferEncoding, err)
+	}
+}
+
+func formatSection(section []int) string {
+	path := make([]string, len(section))
+	for i, index := range section {
+		path[i] = strconv.Itoa(index)
+	}
+	return strings.Join(path, ".")
+}
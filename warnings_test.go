@@ -0,0 +1,174 @@
+package gomime
+
+import (
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const warningsTestMessage = "Content-Type: multipart/mixed; boundary=b\r\n" +
+	"\r\n" +
+	"--b\r\n" +
+	"Content-Type: text/plain; charset=x-unknown\r\n" +
+	"\r\n" +
+	"text\r\n" +
+	"--b\r\n" +
+	"Content-Type: multipart/alternative; boundary=c\r\n" +
+	"\r\n" +
+	"--c\r\n" +
+	"Content-Type: text/plain\r\n" +
+	"Content-Transfer-Encoding: x-unknown\r\n" +
+	"\r\n" +
+	"text\r\n" +
+	"--c--\r\n" +
+	"--b\r\n" +
+	"Content-Type: application/octet-stream\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"!!!!\r\n"
+
+func TestVisitorDiagnostics(t *testing.T) {
+	for _, newVisitor := range []func(VisitAcceptor) *MimeVisitor{NewMimeVisitor, NewStreamingMimeVisitor} {
+		mm, err := mail.ReadMessage(strings.NewReader(warningsTestMessage))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var handled []Warning
+		diagnostics := NewDiagnostics()
+		diagnostics.Handler = func(w Warning) { handled = append(handled, w) }
+
+		plainTextCollector := NewPlainTextCollector(NewMIMEPrinter())
+		plainTextCollector.SetDiagnostics(diagnostics)
+		attachmentsCollector := NewAttachmentsCollector(plainTextCollector)
+		attachmentsCollector.SetDiagnostics(diagnostics)
+		visitor := newVisitor(attachmentsCollector)
+		visitor.SetDiagnostics(diagnostics)
+
+		if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+			t.Fatal("visit error", err)
+		}
+
+		var warnings []string
+		for _, w := range diagnostics.Warnings {
+			warnings = append(warnings, w.Section+" "+w.Code.String())
+		}
+		// buffered visitor reads all parts before visiting them
+		sort.Strings(warnings)
+		expected := " missing boundary terminator,1 unknown charset,2.1 unknown transfer encoding,3 bad base64"
+		if strings.Join(warnings, ",") != expected {
+			t.Errorf("unexpected warnings %q", warnings)
+		}
+		if len(handled) != len(diagnostics.Warnings) {
+			t.Error("handler was not called for all warnings", handled)
+		}
+		if plain := plainTextCollector.GetPlainText(); plain != "texttext" {
+			t.Errorf("unexpected plain text %q", plain)
+		}
+	}
+}
+
+func TestParseWarnings(t *testing.T) {
+	root, err := Parse(strings.NewReader(warningsTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+
+	var warnings []string
+	_ = root.Walk(func(p *Part) error {
+		for _, w := range p.Warnings {
+			warnings = append(warnings, w.String())
+		}
+		return nil
+	})
+	expected := "missing boundary terminator," +
+		"part 1: unknown charset: can not get encodig for 'x-unknown' (or 'x-unknown')," +
+		"part 2.1: unknown transfer encoding: unsupported Content-Transfer-Encoding 'x-unknown'," +
+		"part 3: bad base64: repaired 4 malformed bytes"
+	if strings.Join(warnings, ",") != expected {
+		t.Errorf("unexpected warnings %q", warnings)
+	}
+}
+
+func TestBodyCollectorCharsetFallback(t *testing.T) {
+	message := "Content-Type: multipart/alternative; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=utf-7\r\n" +
+		"\r\n" +
+		"Hi Mom -+Jjo--!\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/html; charset=utf-7\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n" +
+		"\r\n" +
+		"<p>broken +2D3</p>\r\n" +
+		"--b--\r\n"
+
+	mm, err := mail.ReadMessage(strings.NewReader(message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	diagnostics := NewDiagnostics()
+	bodyCollector := NewBodyCollector(NewMIMEPrinter())
+	bodyCollector.SetDiagnostics(diagnostics)
+	visitor := NewStreamingMimeVisitor(bodyCollector)
+	visitor.SetDiagnostics(diagnostics)
+	if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+		t.Fatal("visit error", err)
+	}
+
+	if len(diagnostics.Warnings) != 1 || diagnostics.Warnings[0].Section != "2" || diagnostics.Warnings[0].Code != WarningBadCharset {
+		t.Errorf("unexpected warnings %v", diagnostics.Warnings)
+	}
+	if body, mediaType := bodyCollector.GetBody(); body != "<p>broken +2D3</p>" || mediaType != "text/html" {
+		t.Errorf("unexpected body %q %v", body, mediaType)
+	}
+	if bodyCollector.plainBodyBuffer.String() != "Hi Mom -☺-!" {
+		t.Errorf("unexpected plain body %q", bodyCollector.plainBodyBuffer.String())
+	}
+}
+
+func TestInvalidUTF8AfterSample(t *testing.T) {
+	testData := map[string]int{
+		strings.Repeat("a", detectSampleSize) + "caf\xe9":                   1,
+		strings.Repeat("a", detectSampleSize-1) + strings.Repeat("é", 5000): 0,
+	}
+	for text, expected := range testData {
+		message := "Content-Type: text/plain\r\n\r\n" + text
+		mm, err := mail.ReadMessage(strings.NewReader(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		diagnostics := NewDiagnostics()
+		plainTextCollector := NewPlainTextCollector(NewMIMEPrinter())
+		plainTextCollector.SetDiagnostics(diagnostics)
+		visitor := NewStreamingMimeVisitor(plainTextCollector)
+		visitor.SetDiagnostics(diagnostics)
+		if err = VisitAll(mm.Body, textproto.MIMEHeader(mm.Header), visitor); err != nil {
+			t.Fatal("visit error", err)
+		}
+		if len(diagnostics.Warnings) != expected {
+			t.Errorf("expected %d warnings but have %v", expected, diagnostics.Warnings)
+		}
+		for _, warning := range diagnostics.Warnings {
+			if warning.Code != WarningMissingCharset {
+				t.Errorf("unexpected warning %v", warning)
+			}
+		}
+		if plainTextCollector.GetPlainText() != text {
+			t.Error("text was changed")
+		}
+	}
+}
+
+func TestParseBadCharset(t *testing.T) {
+	root, err := Parse(strings.NewReader("Content-Type: text/plain; charset=utf-7\r\n\r\nbroken +2D3"))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if len(root.Warnings) != 1 || root.Warnings[0].Code != WarningBadCharset || root.Warnings[0].Section != "1" {
+		t.Errorf("unexpected warnings %v", root.Warnings)
+	}
+}
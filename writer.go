@@ -0,0 +1,369 @@
+package gomime
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/textproto"
+	"strings"
+)
+
+// rawHeaderField is one header field as it is in the message including
+// folded lines and line breaks
+type rawHeaderField struct {
+	key string
+	raw []byte
+}
+
+// splitHeaderFields splits header block to fields, the empty line
+// terminating the block is dropped
+func splitHeaderFields(rawHeader []byte) (fields []rawHeaderField) {
+	for start := 0; start < len(rawHeader); {
+		end := bytes.IndexByte(rawHeader[start:], '\n')
+		if end < 0 {
+			end = len(rawHeader)
+		} else {
+			end += start + 1
+		}
+		line := rawHeader[start:end]
+		start = end
+
+		switch {
+		case len(bytes.TrimRight(line, "\r\n")) == 0:
+			return
+		case (line[0] == ' ' || line[0] == '\t') && len(fields) > 0:
+			last := &fields[len(fields)-1]
+			last.raw = append(last.raw, line...)
+		default:
+			key := line
+			if colon := bytes.IndexByte(line, ':'); colon >= 0 {
+				key = line[:colon]
+			}
+			fields = append(fields, rawHeaderField{
+				key: textproto.CanonicalMIMEHeaderKey(string(bytes.TrimSpace(key))),
+				raw: append([]byte{}, line...),
+			})
+		}
+	}
+	return
+}
+
+// lineBreak returns line break used in the header of the part
+func (p *Part) lineBreak() string {
+	if i := bytes.IndexByte(p.rawHeader, '\n'); i >= 0 && (i == 0 || p.rawHeader[i-1] != '\r') {
+		return "\n"
+	}
+	return "\r\n"
+}
+
+// formatHeaderField returns folded header field with line break of the
+// part. Non-ASCII value is encoded like by MessageBuilder.SetHeader.
+func (p *Part) formatHeaderField(key, value string) []byte {
+	value = encodeHeaderValue(key, value)
+	buf := &bytes.Buffer{}
+	writeHeaderField(buf, key, value)
+	if lineBreak := p.lineBreak(); lineBreak != "\r\n" {
+		return bytes.Replace(buf.Bytes(), []byte("\r\n"), []byte(lineBreak), -1)
+	}
+	return buf.Bytes()
+}
+
+// ErrInvalidHeaderField is returned for header key which is not valid
+// field name or value with line break, which would start new header field
+var ErrInvalidHeaderField = errors.New("gomime: invalid header field")
+
+// checkHeaderField validates header field set by user, name is printable
+// ASCII without colon
+func checkHeaderField(key, value string) error {
+	if key == "" || strings.ContainsAny(value, "\r\n") {
+		return ErrInvalidHeaderField
+	}
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; c <= ' ' || c >= 0x7f || c == ':' {
+			return ErrInvalidHeaderField
+		}
+	}
+	return nil
+}
+
+// SetHeader replaces all values of header key. The first field with the
+// key is replaced in place, other header fields are kept byte-exact. It
+// fails with ErrInvalidHeaderField for invalid key or value with line
+// break.
+func (p *Part) SetHeader(key, value string) error {
+	if err := checkHeaderField(key, value); err != nil {
+		return err
+	}
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	p.Header.Set(key, value)
+	p.setHeaderFields(p.replaceHeaderField(key, value))
+	return nil
+}
+
+// replaceHeaderField returns header fields of the part with the first field
+// with key replaced and other fields with key removed
+func (p *Part) replaceHeaderField(key, value string) []rawHeaderField {
+	formatted := p.formatHeaderField(key, value)
+	fields := splitHeaderFields(p.rawHeader)
+	edited := fields[:0]
+	for _, field := range fields {
+		if field.key == key {
+			if formatted == nil {
+				continue
+			}
+			field.raw, formatted = formatted, nil
+		}
+		edited = append(edited, field)
+	}
+	if formatted != nil {
+		edited = append(edited, rawHeaderField{key, formatted})
+	}
+	return edited
+}
+
+// AddHeader adds header field at the end of header. Key and value are
+// validated like in SetHeader.
+func (p *Part) AddHeader(key, value string) error {
+	if err := checkHeaderField(key, value); err != nil {
+		return err
+	}
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	fields := append(splitHeaderFields(p.rawHeader), rawHeaderField{key, p.formatHeaderField(key, value)})
+	p.Header.Add(key, value)
+	p.setHeaderFields(fields)
+	return nil
+}
+
+// DelHeader removes all header fields with key
+func (p *Part) DelHeader(key string) {
+	key = textproto.CanonicalMIMEHeaderKey(key)
+	fields := splitHeaderFields(p.rawHeader)
+	edited := fields[:0]
+	for _, field := range fields {
+		if field.key != key {
+			edited = append(edited, field)
+		}
+	}
+	p.Header.Del(key)
+	p.setHeaderFields(edited)
+}
+
+func (p *Part) setHeaderFields(fields []rawHeaderField) {
+	p.rawHeader = p.joinHeaderFields(fields)
+	_ = p.parseContentHeaders()
+	p.modified = true
+}
+
+// joinHeaderFields returns header block of fields
+func (p *Part) joinHeaderFields(fields []rawHeaderField) []byte {
+	buf := &bytes.Buffer{}
+	for _, field := range fields {
+		buf.Write(field.raw)
+	}
+	buf.WriteString(p.lineBreak())
+	return buf.Bytes()
+}
+
+// SetBody replaces raw body of non-multipart part. The body must be
+// already encoded by content transfer encoding of the part. Embedded
+// message of the part is dropped.
+func (p *Part) SetBody(body []byte) error {
+	if strings.HasPrefix(p.MediaType, "multipart/") {
+		return errors.New("gomime: can not set body of multipart")
+	}
+	p.rawBody, p.Children, p.modified = body, nil, true
+	return nil
+}
+
+// Remove removes the part from its parent multipart. The last part of
+// multipart can not be removed, multipart without parts is not valid and
+// ErrAllPartsRemoved is returned.
+func (p *Part) Remove() error {
+	i, err := p.index()
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(p.Parent.MediaType, "multipart/") {
+		return errors.New("gomime: part is not in multipart")
+	}
+	if len(p.Parent.Children) == 1 {
+		return ErrAllPartsRemoved
+	}
+	p.Parent.Children = append(p.Parent.Children[:i:i], p.Parent.Children[i+1:]...)
+	p.Parent.modified = true
+	p.Parent = nil
+	return nil
+}
+
+// Replace puts part q to the place of the part in its parent
+func (p *Part) Replace(q *Part) error {
+	i, err := p.index()
+	if err != nil {
+		return err
+	}
+	q.Parent = p.Parent
+	p.Parent.Children[i] = q
+	p.Parent.modified = true
+	p.Parent = nil
+	return nil
+}
+
+// index returns index of the part in children of its parent
+func (p *Part) index() (int, error) {
+	if p.Parent == nil {
+		return 0, errors.New("gomime: part has no parent")
+	}
+	for i, sibling := range p.Parent.Children {
+		if sibling == p {
+			return i, nil
+		}
+	}
+	return 0, errors.New("gomime: part is not child of its parent")
+}
+
+// isModified returns true when the part or any descendant was edited
+func (p *Part) isModified() bool {
+	if p.modified {
+		return true
+	}
+	for _, child := range p.Children {
+		if child.isModified() {
+			return true
+		}
+	}
+	return false
+}
+
+// WriteTo writes the part with its header. Part which was not edited is
+// written byte-exact as it was parsed, including header order, folding,
+// line breaks, preamble and epilogue. Only edited parts and multipart
+// delimiters around them are serialized again.
+func (p *Part) WriteTo(w io.Writer) (n int64, err error) {
+	pw := &partWriter{w: w}
+	p.write(pw)
+	return pw.n, pw.err
+}
+
+func (p *Part) write(pw *partWriter) {
+	if p.isModified() && len(p.Children) == 1 && !strings.HasPrefix(p.MediaType, "multipart/") {
+		p.writeMessage(pw)
+		return
+	}
+	pw.write(p.rawHeader)
+	switch {
+	case !p.isModified():
+		pw.write(p.rawBody)
+	case strings.HasPrefix(p.MediaType, "multipart/"):
+		p.writeMultipartBody(pw)
+	default:
+		pw.write(p.rawBody)
+	}
+}
+
+// writeMultipartBody writes children with original delimiters while the
+// boundary is not changed. Missing delimiters are created.
+func (p *Part) writeMultipartBody(pw *partWriter) {
+	boundary := p.MediaTypeParams["boundary"]
+	if boundary == "" {
+		pw.fail(errors.New("multipart: boundary is empty"))
+		return
+	}
+	sameBoundary := boundary == p.boundary
+	lineBreak := p.lineBreak()
+
+	preamble, openDelimiters := p.rawBody, p.delimiters
+	if len(p.delimiters) > 0 {
+		preamble = p.rawBody[:p.delimiters[0].Start]
+		if p.closed {
+			openDelimiters = p.delimiters[:len(p.delimiters)-1]
+		}
+	}
+	pw.write(preamble)
+
+	for i, child := range p.Children {
+		switch {
+		case sameBoundary && i < len(openDelimiters):
+			pw.write(p.rawBody[openDelimiters[i].Start:openDelimiters[i].End])
+		case i == 0 && len(preamble) == 0:
+			pw.write([]byte("--" + boundary + lineBreak))
+		default:
+			pw.write([]byte(lineBreak + "--" + boundary + lineBreak))
+		}
+
+		if sameBoundary && !child.isModified() {
+			child.write(pw)
+			continue
+		}
+		buf := &bytes.Buffer{}
+		if _, err := child.WriteTo(buf); err != nil {
+			pw.fail(err)
+			return
+		}
+		if bytes.Contains(buf.Bytes(), []byte("--"+boundary)) {
+			pw.fail(fmt.Errorf("gomime: part %v contains boundary of its parent", child.Section()))
+			return
+		}
+		pw.write(buf.Bytes())
+	}
+
+	if sameBoundary && p.closed {
+		pw.write(p.rawBody[p.delimiters[len(p.delimiters)-1].Start:])
+		return
+	}
+	pw.write([]byte(lineBreak + "--" + boundary + "--" + lineBreak))
+	if p.closed {
+		pw.write(p.rawBody[p.delimiters[len(p.delimiters)-1].End:])
+	}
+}
+
+// writeMessage writes part with edited embedded message encoded by content
+// transfer encoding of the part. Legacy and unknown encodings can not be
+// encoded, such message is encoded by base64 and Content-Transfer-Encoding
+// is rewritten in the written header.
+func (p *Part) writeMessage(pw *partWriter) {
+	header, encoding := p.rawHeader, p.TransferEncoding
+	switch encoding {
+	case "7bit", "8bit", "binary", "":
+		pw.write(header)
+		p.Children[0].write(pw)
+		return
+	case "quoted-printable", "base64":
+	default:
+		encoding = "base64"
+		header = p.joinHeaderFields(p.replaceHeaderField("Content-Transfer-Encoding", encoding))
+	}
+	message, encoded := &bytes.Buffer{}, &bytes.Buffer{}
+	if _, err := p.Children[0].WriteTo(message); err != nil {
+		pw.fail(err)
+		return
+	}
+	if err := writeEncodedBody(encoded, message.Bytes(), encoding); err != nil {
+		pw.fail(err)
+		return
+	}
+	pw.write(header)
+	pw.write(encoded.Bytes())
+}
+
+// partWriter counts written bytes and keeps the first error
+type partWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (pw *partWriter) write(b []byte) {
+	if pw.err != nil {
+		return
+	}
+	n, err := pw.w.Write(b)
+	pw.n += int64(n)
+	pw.err = err
+}
+
+func (pw *partWriter) fail(err error) {
+	if pw.err == nil {
+		pw.err = err
+	}
+}
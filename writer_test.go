@@ -0,0 +1,211 @@
+package gomime
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func writePart(t *testing.T, p *Part) string {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	n, err := p.WriteTo(buf)
+	if err != nil {
+		t.Fatal("write error", err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("expected %d written bytes but have %d", buf.Len(), n)
+	}
+	return buf.String()
+}
+
+func TestWriteUnmodified(t *testing.T) {
+	testData := []string{
+		partTestMessage,
+		forwardedTestMessage,
+		"subject: folded\n\tline\nCONTENT-TYPE: multipart/mixed;\n boundary=b\n\npreamble\n--b  \n\nfirst\n--b\nX: y\n\nsecond\n--b--\nepilogue\n",
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n--b\r\n\r\nnot closed\r\n",
+	}
+	for _, message := range testData {
+		root, err := Parse(strings.NewReader(message))
+		if err != nil {
+			t.Fatal("parse error", err)
+		}
+		if written := writePart(t, root); written != message {
+			t.Errorf("expected byte-exact output %q but have %q", message, written)
+		}
+	}
+}
+
+func TestWriteRemovedPart(t *testing.T) {
+	root, err := Parse(strings.NewReader(partTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if err = root.Children[1].Remove(); err != nil {
+		t.Fatal("remove error", err)
+	}
+
+	expected := strings.Replace(partTestMessage, "\r\n--outer\r\n"+
+		"Content-Type: application/octet-stream\r\n"+
+		"Content-Transfer-Encoding: base64\r\n"+
+		"Content-Disposition: attachment; filename=\"data.bin\"\r\n"+
+		"\r\n"+
+		"AAECAwQF", "", 1)
+	if written := writePart(t, root); written != expected {
+		t.Errorf("expected\n%q\nbut have\n%q", expected, written)
+	}
+
+	if err = root.Remove(); err == nil {
+		t.Error("expected error when removing root")
+	}
+	if err = root.Children[0].Remove(); err != ErrAllPartsRemoved {
+		t.Error("expected ErrAllPartsRemoved for the last part but have", err)
+	}
+	if written := writePart(t, root); written != expected {
+		t.Errorf("expected the last part kept but have\n%q", written)
+	}
+}
+
+func TestWriteReplacedPart(t *testing.T) {
+	root, err := Parse(strings.NewReader(partTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	placeholder, err := Parse(strings.NewReader("Content-Type: text/plain\r\n\r\nremoved"))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if err = root.Children[0].Children[1].Replace(placeholder); err != nil {
+		t.Fatal("replace error", err)
+	}
+	if err = root.Children[1].SetHeader("content-disposition", "attachment; filename=\"removed.bin\""); err != nil {
+		t.Fatal("set header error", err)
+	}
+	if err = root.Children[1].AddHeader("X-Removed", "yes"); err != nil {
+		t.Fatal("add header error", err)
+	}
+
+	written := writePart(t, root)
+	if !strings.HasPrefix(written, "From: John Doe <example@example.com>\r\nMIME-Version: 1.0\r\n") {
+		t.Errorf("expected unmodified root header but have %q", written)
+	}
+	if !strings.Contains(written, "--inner\r\nContent-Type: text/plain\r\n\r\nremoved\r\n--inner--\r\n") {
+		t.Errorf("expected replaced part but have %q", written)
+	}
+	expectedHeader := "Content-Type: application/octet-stream\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"Content-Disposition: attachment; filename=\"removed.bin\"\r\n" +
+		"X-Removed: yes\r\n" +
+		"\r\n"
+	if !strings.Contains(written, expectedHeader) {
+		t.Errorf("expected edited header in place but have %q", written)
+	}
+
+	reparsed, err := Parse(strings.NewReader(written))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if html := reparsed.Children[0].Children[1]; html.MediaType != "text/plain" {
+		t.Errorf("unexpected replaced part %v", html.MediaType)
+	}
+	if att := reparsed.Children[1]; att.Header.Get("X-Removed") != "yes" || att.MediaType != "application/octet-stream" {
+		t.Errorf("unexpected edited part %v", att.Header)
+	}
+}
+
+func TestWriteEncodedEmbeddedMessage(t *testing.T) {
+	message := "Content-Type: message/rfc822\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		base64.StdEncoding.EncodeToString([]byte("Subject: hidden\r\n\r\ntext"))
+
+	root, err := Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if err = root.Children[0].SetBody([]byte("edited")); err != nil {
+		t.Fatal("set body error", err)
+	}
+
+	reparsed, err := Parse(strings.NewReader(writePart(t, root)))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if len(reparsed.Children) != 1 {
+		t.Fatal("expected embedded message")
+	}
+	if body, _ := ioutil.ReadAll(reparsed.Children[0].Body()); string(body) != "edited" {
+		t.Errorf("unexpected embedded body %q", body)
+	}
+	if subject := reparsed.Children[0].Header.Get("Subject"); subject != "hidden" {
+		t.Errorf("unexpected embedded subject %q", subject)
+	}
+}
+
+func TestWriteLegacyEncodedEmbeddedMessage(t *testing.T) {
+	message := "Content-Type: message/rfc822\r\n" +
+		"Content-Transfer-Encoding: x-uuencode\r\n" +
+		"X-Other: kept\r\n" +
+		"\r\n" +
+		uuencode([]byte("Subject: hidden\r\n\r\ntext"))
+
+	root, err := Parse(strings.NewReader(message))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if err = root.Children[0].SetBody([]byte("edited")); err != nil {
+		t.Fatal("set body error", err)
+	}
+
+	reparsed, err := Parse(strings.NewReader(writePart(t, root)))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if reparsed.TransferEncoding != "base64" || reparsed.Header.Get("X-Other") != "kept" {
+		t.Errorf("unexpected header %v", reparsed.Header)
+	}
+	if root.TransferEncoding != "x-uuencode" {
+		t.Error("written part was changed")
+	}
+	if len(reparsed.Children) != 1 {
+		t.Fatal("expected embedded message")
+	}
+	if body, _ := ioutil.ReadAll(reparsed.Children[0].Body()); string(body) != "edited" {
+		t.Errorf("unexpected embedded body %q", body)
+	}
+}
+
+func TestWriteBoundaryConflict(t *testing.T) {
+	root, err := Parse(strings.NewReader(partTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if err = root.Children[1].SetBody([]byte("--outer--")); err != nil {
+		t.Fatal("set body error", err)
+	}
+	if _, err = root.WriteTo(ioutil.Discard); err == nil {
+		t.Error("expected error for body containing boundary")
+	}
+}
+
+func TestWriteInvalidHeaderField(t *testing.T) {
+	root, err := Parse(strings.NewReader(partTestMessage))
+	if err != nil {
+		t.Fatal("parse error", err)
+	}
+	if err = root.SetHeader("Subject", "hi\r\nBcc: victim@example.com"); err != ErrInvalidHeaderField {
+		t.Error("expected invalid header field but have", err)
+	}
+	if err = root.AddHeader("X-Note", "a\nb"); err != ErrInvalidHeaderField {
+		t.Error("expected invalid header field but have", err)
+	}
+	if err = root.AddHeader("Bcc: victim@example.com\r\nX-Note", "a"); err != ErrInvalidHeaderField {
+		t.Error("expected invalid header field but have", err)
+	}
+	if written := writePart(t, root); written != partTestMessage {
+		t.Errorf("expected unchanged message but have %q", written)
+	}
+}